@@ -0,0 +1,44 @@
+package cmd
+
+import (
+	"nametidy/internal/cleaner"
+
+	"github.com/spf13/cobra"
+	"gorm.io/gorm"
+)
+
+var applyCmd = &cobra.Command{
+	Use:   "apply",
+	Short: "Renames files as listed in a mapping file or a plan saved by --plan-out.",
+	RunE:  runWithCommonSetup("applying renames", runApply),
+}
+
+func runApply(cmd *cobra.Command, db *gorm.DB, dirPath string, dryRun bool) error {
+	mapPath, _ := cmd.Flags().GetString("map")
+	planPath, _ := cmd.Flags().GetString("plan")
+	planOut, _ := cmd.Flags().GetString("plan-out")
+
+	if planPath != "" {
+		return cleaner.ApplyPlanFile(db, dirPath, planPath, dryRun, planOut)
+	}
+	policy, err := conflictPolicy(cmd)
+	if err != nil {
+		return usage("Invalid --on-conflict value", err)
+	}
+	return cleaner.ApplyMapping(db, dirPath, mapPath, policy, dryRun, planOut)
+}
+
+func init() {
+	applyCmd.Flags().StringP("path", "p", "", "Path to the target directory; relative paths in the mapping are taken from here")
+	applyCmd.Flags().BoolP("dry-run", "d", false, "Show rename results only")
+	addPlanOutFlag(applyCmd)
+	applyCmd.Flags().BoolP("verbose", "v", false, "Show detailed logs")
+	applyCmd.Flags().StringP("map", "m", "", "Mapping file of old,new pairs (.csv, .tsv or .json)")
+	applyCmd.Flags().String("plan", "", "Plan file saved with --dry-run --plan-out; applied only if its files did not change")
+	addConflictFlag(applyCmd, cleaner.ConflictAbort)
+	applyCmd.MarkFlagRequired("path")
+	applyCmd.MarkFlagsOneRequired("map", "plan")
+	applyCmd.MarkFlagsMutuallyExclusive("map", "plan")
+
+	rootCmd.AddCommand(applyCmd)
+}
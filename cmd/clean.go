@@ -1,21 +1,86 @@
 package cmd
 
 import (
+	"fmt"
+	"strings"
+
 	"nametidy/internal/cleaner"
+	"nametidy/internal/rules"
+
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"gorm.io/gorm"
 )
 
 var cleanCmd = &cobra.Command{
 	Use:   "clean",
 	Short: "Cleans up file names.",
-    Run:   runWithCommonSetup("file name cleanup", cleaner.Clean),
+	RunE:  runWithCommonSetup("file name cleanup", runClean),
+}
+
+func runClean(cmd *cobra.Command, db *gorm.DB, dirPath string, dryRun bool) error {
+	planOut, _ := cmd.Flags().GetString("plan-out")
+
+	policy, err := conflictPolicy(cmd)
+	if err != nil {
+		return usage("Invalid --on-conflict value", err)
+	}
+	pipeline, err := loadProfile(cmd)
+	if err != nil {
+		return usage("Invalid cleaning rules", err)
+	}
+	return cleaner.Clean(db, dirPath, pipeline, policy, dryRun, planOut)
+}
+
+// loadProfile builds the rule pipeline selected with --profile (or --unicode)
+// from the profiles section of the config file. --transliterate runs before
+// the profile's own rules and --case / --ext-case after them.
+func loadProfile(cmd *cobra.Command) (*rules.Pipeline, error) {
+	name, _ := cmd.Flags().GetString("profile")
+	if unicode, _ := cmd.Flags().GetBool("unicode"); unicode {
+		if cmd.Flags().Changed("profile") {
+			return nil, fmt.Errorf("--unicode and --profile cannot be used together")
+		}
+		name = rules.UnicodeProfile
+	}
+	pipeline, err := rules.Parse(name, viper.Get("profiles."+name))
+	if err != nil {
+		return nil, err
+	}
+	if transliterate, _ := cmd.Flags().GetBool("transliterate"); transliterate {
+		if pipeline, err = pipeline.Prepend(rules.Spec{"rule": "transliterate"}); err != nil {
+			return nil, err
+		}
+	}
+
+	var post []rules.Spec
+	if style, _ := cmd.Flags().GetString("case"); style != "" {
+		post = append(post, rules.Spec{"rule": "case", "style": style})
+	}
+	if style, _ := cmd.Flags().GetString("ext-case"); style != "" {
+		if style != "lower" && style != "upper" {
+			return nil, fmt.Errorf("unknown --ext-case %q (expected lower or upper)", style)
+		}
+		post = append(post, rules.Spec{"rule": "case", "style": style, "target": "extension"})
+	}
+	if len(post) > 0 {
+		return pipeline.Append(post...)
+	}
+	return pipeline, nil
 }
 
 func init() {
 	cleanCmd.Flags().StringP("path", "p", "", "Path to the target directory")
 	cleanCmd.Flags().BoolP("dry-run", "d", false, "Show rename results only")
+	addPlanOutFlag(cleanCmd)
 	cleanCmd.Flags().BoolP("verbose", "v", false, "Show detailed logs")
+	addConflictFlag(cleanCmd, cleaner.ConflictSuffix)
+	cleanCmd.Flags().String("profile", rules.DefaultProfile, "Cleaning profile from the profiles section of the config file")
+	cleanCmd.Flags().Bool("unicode", false, "Keep letters and digits of any script (same as --profile "+rules.UnicodeProfile+")")
+	cleanCmd.Flags().Bool("transliterate", false, "Spell accented Latin, Cyrillic, Greek and kana in ASCII before cleaning")
+	cleanCmd.Flags().String("case", "", "Change the case of file names ("+strings.Join(rules.CaseStyles(), ", ")+")")
+	cleanCmd.Flags().String("ext-case", "", "Change the case of extensions (lower, upper)")
 	cleanCmd.MarkFlagRequired("path")
 
 	rootCmd.AddCommand(cleanCmd)
-}
\ No newline at end of file
+}
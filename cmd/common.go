@@ -1,38 +1,157 @@
 package cmd
 
 import (
-    "nametidy/internal/cleaner"
-    "nametidy/internal/utils"
-    "github.com/spf13/cobra"
-    "gorm.io/gorm"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"nametidy/internal/cleaner"
+	"nametidy/internal/utils"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"gorm.io/gorm"
 )
 
-type operationFunc func(db *gorm.DB, dirPath string, dryRun bool) error
-
-func runWithCommonSetup(opName string, op operationFunc) func(cmd *cobra.Command, args []string) {
-    return func(cmd *cobra.Command, args []string) {
-        dirPath, _ := cmd.Flags().GetString("path")
-        dryRun, _ := cmd.Flags().GetBool("dry-run")
-        verbose, _ := cmd.Flags().GetBool("verbose")
-
-        utils.InitLogger(verbose)
-
-        if !utils.IsDirectory(dirPath) {
-            utils.Error("The specified directory does not exist", nil)
-            return
-        }
-
-        db, err := cleaner.GetDB()
-        if err != nil {
-            utils.Error("Failed to open DB", err)
-            return
-        }
-
-        utils.Info("Starting " + opName + "...")
-        if err := op(db, dirPath, dryRun); err != nil {
-            utils.Error(opName+" failed", err)
-            return
-        }
-        utils.Info(opName + " completed.")
-    }
-}
\ No newline at end of file
+type operationFunc func(cmd *cobra.Command, db *gorm.DB, dirPath string, dryRun bool) error
+
+func runWithCommonSetup(opName string, op operationFunc) func(cmd *cobra.Command, args []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+		dirPath, _ := cmd.Flags().GetString("path")
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		verbose, _ := cmd.Flags().GetBool("verbose")
+
+		utils.InitLogger(verbose)
+
+		if !utils.IsDirectory(dirPath) {
+			return usage("The specified directory does not exist", errors.New(dirPath))
+		}
+		planOut, _ := cmd.Flags().GetString("plan-out")
+		if planOut != "" && !dryRun {
+			return usage("Invalid --plan-out value", errors.New("a plan can only be saved with --dry-run"))
+		}
+
+		db, err := openDB(dirPath)
+		if err != nil {
+			return fatal("Failed to open DB", err)
+		}
+
+		warnIncompleteBatches(db)
+
+		utils.Info("Starting " + opName + "...")
+		if err := op(cmd, db, dirPath, dryRun); err != nil {
+			return failed(opName+" failed", err)
+		}
+		utils.Info(opName + " completed.")
+
+		if !dryRun {
+			applyRetention(db)
+		}
+		return nil
+	}
+}
+
+// applyRetention prunes the history according to the history.max_age and
+// history.keep_last config keys. Without either key nothing is deleted.
+func applyRetention(db *gorm.DB) {
+	maxAge := viper.GetString("history.max_age")
+	keepLast := -1
+	if viper.IsSet("history.keep_last") {
+		keepLast = viper.GetInt("history.keep_last")
+	}
+	if maxAge == "" && keepLast < 0 {
+		return
+	}
+
+	age, err := parseAge(maxAge)
+	if err != nil {
+		utils.Warn(fmt.Sprintf("Ignoring history.max_age: %v", err))
+		return
+	}
+	batches, _, err := cleaner.PruneHistory(db, cleaner.PruneOptions{OlderThan: age, KeepLast: keepLast}, false)
+	if err != nil {
+		utils.Warn(fmt.Sprintf("Failed to apply history retention: %v", err))
+		return
+	}
+	if batches > 0 {
+		utils.Info(fmt.Sprintf("Pruned %d old batch(es) from history", batches))
+	}
+}
+
+// parseAge accepts time.ParseDuration values plus whole days (30d) and weeks
+// (2w). An empty string is zero.
+func parseAge(value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+	units := map[byte]time.Duration{'d': 24 * time.Hour, 'w': 7 * 24 * time.Hour}
+	if unit, ok := units[value[len(value)-1]]; ok {
+		n, err := strconv.Atoi(value[:len(value)-1])
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid age %q", value)
+		}
+		return time.Duration(n) * unit, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid age %q", value)
+	}
+	return d, nil
+}
+
+// openDB opens the history database chosen by resolveDBPath and brings its
+// schema up to date
+func openDB(dirPath string) (*gorm.DB, error) {
+	dbPath, err := resolveDBPath(dirPath)
+	if err != nil {
+		return nil, err
+	}
+	utils.Info("Using history database " + dbPath)
+	return cleaner.GetDB(dbPath)
+}
+
+// resolveDBPath returns the history database selected by --db, NAMETIDY_DB or
+// the db config key. In local mode (--local-db, NAMETIDY_LOCAL_DB or local_db)
+// it lives in .nametidy/ at the target directory, or the nearest parent that
+// already has one, so the history travels with the folder.
+func resolveDBPath(dirPath string) (string, error) {
+	if dbPath := viper.GetString("db"); dbPath != "" {
+		return dbPath, nil
+	}
+	if viper.GetBool("local_db") {
+		if dirPath == "" {
+			dirPath = "."
+		}
+		return cleaner.FindLocalDBPath(dirPath)
+	}
+	return cleaner.DefaultDBPath()
+}
+
+// warnIncompleteBatches points the user to `nametidy recover` when an earlier
+// run was interrupted
+func warnIncompleteBatches(db *gorm.DB) {
+	batches, err := cleaner.FindIncompleteBatches(db)
+	if err != nil || len(batches) == 0 {
+		return
+	}
+	utils.Warn(fmt.Sprintf("%d interrupted batch(es) found; run `nametidy recover` to finish or roll them back", len(batches)))
+}
+
+// addPlanOutFlag registers --plan-out on a command whose dry run can be saved
+// for `apply --plan`
+func addPlanOutFlag(cmd *cobra.Command) {
+	cmd.Flags().String("plan-out", "", "With --dry-run, save the plan to this file for `apply --plan`")
+}
+
+// addConflictFlag registers --on-conflict on a command that renames files,
+// with def as its default policy
+func addConflictFlag(cmd *cobra.Command, def cleaner.ConflictPolicy) {
+	cmd.Flags().String("on-conflict", string(def), "What to do when a new name is already taken (skip, suffix, abort)")
+}
+
+// conflictPolicy reads the --on-conflict flag of the given command
+func conflictPolicy(cmd *cobra.Command) (cleaner.ConflictPolicy, error) {
+	value, _ := cmd.Flags().GetString("on-conflict")
+	return cleaner.ParseConflictPolicy(value)
+}
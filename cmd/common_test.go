@@ -0,0 +1,133 @@
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"nametidy/internal/cleaner"
+
+	"github.com/spf13/viper"
+)
+
+func TestParseAge(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected time.Duration
+		wantErr  bool
+	}{
+		{"", 0, false},
+		{"30d", 30 * 24 * time.Hour, false},
+		{"2w", 14 * 24 * time.Hour, false},
+		{"0d", 0, false},
+		{"12h", 12 * time.Hour, false},
+		{"90m", 90 * time.Minute, false},
+		{"-3d", 0, true},
+		{"-1h", 0, true},
+		{"d", 0, true},
+		{"1.5d", 0, true},
+		{"soon", 0, true},
+	}
+	for _, test := range tests {
+		got, err := parseAge(test.value)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("%q: expected an error, got %v", test.value, got)
+			}
+			continue
+		}
+		if err != nil || got != test.expected {
+			t.Errorf("%q: expected %v, got %v (%v)", test.value, test.expected, got, err)
+		}
+	}
+}
+
+func TestApplyRetention(t *testing.T) {
+	db, err := cleaner.GetDB(filepath.Join(t.TempDir(), "history.db"))
+	if err != nil {
+		t.Fatalf("GetDB failed: %v", err)
+	}
+	now := time.Now()
+	for i, age := range []time.Duration{0, 10 * 24 * time.Hour, 40 * 24 * time.Hour, 50 * 24 * time.Hour} {
+		batch := cleaner.Batch{ID: fmt.Sprintf("clean-%d", i), Operation: "clean", Status: cleaner.StatusApplied, CreatedAt: now.Add(-age)}
+		if err := db.Create(&batch).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	remaining := func() int {
+		batches, err := cleaner.ListBatches(db, cleaner.HistoryFilter{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(batches)
+	}
+	t.Cleanup(viper.Reset)
+
+	// Without any retention key nothing is deleted.
+	applyRetention(db)
+	if n := remaining(); n != 4 {
+		t.Fatalf("expected 4 batches without retention config, got %d", n)
+	}
+
+	// An invalid age is ignored rather than pruning everything.
+	viper.Set("history.max_age", "-30d")
+	applyRetention(db)
+	if n := remaining(); n != 4 {
+		t.Fatalf("expected an invalid max_age to be ignored, got %d batches", n)
+	}
+
+	viper.Set("history.max_age", "30d")
+	applyRetention(db)
+	if n := remaining(); n != 2 {
+		t.Fatalf("expected batches older than 30 days to be pruned, got %d left", n)
+	}
+
+	viper.Set("history.max_age", "")
+	viper.Set("history.keep_last", 1)
+	applyRetention(db)
+	if n := remaining(); n != 1 {
+		t.Errorf("expected only the newest batch to be kept, got %d", n)
+	}
+}
+
+func TestResolveDBPath(t *testing.T) {
+	home := t.TempDir()
+	dir := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Cleanup(viper.Reset)
+	resolve := func(dirPath string) string {
+		viper.Reset()
+		initConfig()
+		path, err := resolveDBPath(dirPath)
+		if err != nil {
+			t.Fatalf("resolveDBPath failed: %v", err)
+		}
+		return path
+	}
+	localDB := filepath.Join(dir, cleaner.LOCAL_DB_DIR, cleaner.LOCAL_DB_FILE)
+
+	if got := resolve(dir); got != filepath.Join(home, cleaner.DB_FILE) {
+		t.Errorf("expected the database in the home directory, got %s", got)
+	}
+
+	t.Setenv("NAMETIDY_LOCAL_DB", "true")
+	if got := resolve(dir); got != localDB {
+		t.Errorf("expected NAMETIDY_LOCAL_DB to select %s, got %s", localDB, got)
+	}
+
+	// NAMETIDY_DB wins over local mode.
+	envDB := filepath.Join(t.TempDir(), "env.db")
+	t.Setenv("NAMETIDY_DB", envDB)
+	if got := resolve(dir); got != envDB {
+		t.Errorf("expected NAMETIDY_DB to select %s, got %s", envDB, got)
+	}
+
+	// So does the db key set by --db.
+	viper.Reset()
+	initConfig()
+	viper.Set("db", "flag.db")
+	if got, _ := resolveDBPath(dir); got != "flag.db" {
+		t.Errorf("expected --db to select flag.db, got %s", got)
+	}
+}
@@ -0,0 +1,112 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"nametidy/internal/cleaner"
+	"nametidy/internal/utils"
+
+	"github.com/spf13/cobra"
+)
+
+var dbCmd = &cobra.Command{
+	Use:   "db",
+	Short: "Maintain the history database",
+}
+
+// sub command: db migrate
+var dbMigrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Apply pending schema migrations to the history database",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dirPath, _ := cmd.Flags().GetString("path")
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		verbose, _ := cmd.Flags().GetBool("verbose")
+
+		utils.InitLogger(verbose)
+
+		dbPath, err := resolveDBPath(dirPath)
+		if err != nil {
+			return fatal("Failed to locate DB", err)
+		}
+		db, err := cleaner.OpenDB(dbPath)
+		if err != nil {
+			return fatal("Failed to open DB", err)
+		}
+
+		migrations, err := cleaner.Migrate(db, dryRun)
+		for _, m := range migrations {
+			if dryRun {
+				fmt.Printf("[DRY-RUN] Pending migration %s\n", m)
+			} else {
+				fmt.Printf("Applied migration %s\n", m)
+			}
+		}
+		if err != nil {
+			return fatal("Failed to migrate DB", err)
+		}
+		if len(migrations) == 0 {
+			fmt.Printf("%s is up to date (schema version %d).\n", dbPath, cleaner.LatestSchemaVersion())
+		}
+		return nil
+	},
+}
+
+// sub command: db check
+var dbCheckCmd = &cobra.Command{
+	Use:   "check",
+	Short: "Report the schema version and integrity of the history database",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dirPath, _ := cmd.Flags().GetString("path")
+		verbose, _ := cmd.Flags().GetBool("verbose")
+
+		utils.InitLogger(verbose)
+
+		dbPath, err := resolveDBPath(dirPath)
+		if err != nil {
+			return fatal("Failed to locate DB", err)
+		}
+		if !utils.FileExists(dbPath) {
+			return fatal("DB not found", fmt.Errorf("%s does not exist", dbPath))
+		}
+		db, err := cleaner.OpenDB(dbPath)
+		if err != nil {
+			return fatal("Failed to open DB", err)
+		}
+
+		status, err := cleaner.CheckDB(db)
+		if err != nil {
+			return fatal("Failed to check DB", err)
+		}
+
+		fmt.Printf("Database:       %s\n", dbPath)
+		fmt.Printf("Schema version: %d (latest %d)\n", status.Version, status.Latest)
+		fmt.Printf("Integrity:      %s\n", status.Integrity)
+		switch {
+		case status.Version > status.Latest:
+			return fatal("Unsupported DB", fmt.Errorf("written by a newer nametidy; please upgrade"))
+		case len(status.Pending) > 0:
+			fmt.Printf("Pending:        %s\n", strings.Join(status.Pending, ", "))
+			fmt.Println("Run `nametidy db migrate` to apply them.")
+		case len(status.Missing) > 0:
+			return fatal("Broken schema", fmt.Errorf("missing %s", strings.Join(status.Missing, ", ")))
+		}
+		if status.Integrity != "ok" {
+			return fatal("Integrity check failed", fmt.Errorf("%s", status.Integrity))
+		}
+		return nil
+	},
+}
+
+func init() {
+	for _, c := range []*cobra.Command{dbMigrateCmd, dbCheckCmd} {
+		c.Flags().StringP("path", "p", "", "Target directory (selects the database in --local-db mode)")
+		c.Flags().BoolP("verbose", "v", false, "Show detailed logs")
+	}
+	dbMigrateCmd.Flags().BoolP("dry-run", "d", false, "List pending migrations only")
+
+	dbCmd.AddCommand(dbMigrateCmd)
+	dbCmd.AddCommand(dbCheckCmd)
+	rootCmd.AddCommand(dbCmd)
+}
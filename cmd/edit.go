@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"nametidy/internal/cleaner"
+
+	"github.com/spf13/cobra"
+	"gorm.io/gorm"
+)
+
+var editCmd = &cobra.Command{
+	Use:   "edit",
+	Short: "Renames files by editing their names in $EDITOR.",
+	RunE:  runWithCommonSetup("interactive rename", runEdit),
+}
+
+func runEdit(cmd *cobra.Command, db *gorm.DB, dirPath string, dryRun bool) error {
+	planOut, _ := cmd.Flags().GetString("plan-out")
+
+	policy, err := conflictPolicy(cmd)
+	if err != nil {
+		return usage("Invalid --on-conflict value", err)
+	}
+	return cleaner.Edit(db, dirPath, runEditor, policy, dryRun, planOut)
+}
+
+// runEditor opens path in $VISUAL or $EDITOR (which may carry arguments, e.g.
+// "code --wait") and waits for it to exit
+func runEditor(path string) error {
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	args := strings.Fields(editor)
+	if len(args) == 0 {
+		args = []string{"vi"}
+		if runtime.GOOS == "windows" {
+			args = []string{"notepad"}
+		}
+	}
+	c := exec.Command(args[0], append(args[1:], path)...)
+	c.Stdin, c.Stdout, c.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := c.Run(); err != nil {
+		return fmt.Errorf("%s: %w", args[0], err)
+	}
+	return nil
+}
+
+func init() {
+	editCmd.Flags().StringP("path", "p", "", "Path to the target directory")
+	editCmd.Flags().BoolP("dry-run", "d", false, "Show rename results only")
+	addPlanOutFlag(editCmd)
+	editCmd.Flags().BoolP("verbose", "v", false, "Show detailed logs")
+	addConflictFlag(editCmd, cleaner.ConflictSuffix)
+	editCmd.MarkFlagRequired("path")
+
+	rootCmd.AddCommand(editCmd)
+}
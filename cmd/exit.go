@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"errors"
+
+	"nametidy/internal/cleaner"
+)
+
+// Exit codes of nametidy
+const (
+	ExitOK          = 0
+	ExitFatal       = 1 // the command failed
+	ExitUsage       = 2 // invalid flags, arguments or paths
+	ExitNothingToDo = 3 // there was nothing to rename, undo or redo
+	ExitPartial     = 4 // some files could not be processed
+)
+
+// exitError is returned by the commands. It carries the message logged by
+// Execute and the exit code.
+type exitError struct {
+	code int
+	msg  string
+	err  error
+}
+
+func (e *exitError) Error() string {
+	if e.err == nil {
+		return e.msg
+	}
+	return e.msg + ": " + e.err.Error()
+}
+
+func (e *exitError) Unwrap() error { return e.err }
+
+// fatal reports a failure with ExitFatal
+func fatal(msg string, err error) error {
+	return &exitError{code: ExitFatal, msg: msg, err: err}
+}
+
+// usage reports invalid input with ExitUsage
+func usage(msg string, err error) error {
+	return &exitError{code: ExitUsage, msg: msg, err: err}
+}
+
+// failed reports the error of an operation, choosing the exit code from it.
+// Errors that already carry a code, such as usage errors, are passed on
+// as-is, and "nothing to do" is reported on its own.
+func failed(msg string, err error) error {
+	var coded *exitError
+	var incomplete *cleaner.IncompleteError
+	switch {
+	case errors.As(err, &coded):
+		return coded
+	case errors.Is(err, cleaner.ErrNothingToDo):
+		return &exitError{code: ExitNothingToDo, msg: err.Error()}
+	case errors.As(err, &incomplete):
+		return &exitError{code: ExitPartial, msg: msg, err: err}
+	}
+	return fatal(msg, err)
+}
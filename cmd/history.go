@@ -1,6 +1,11 @@
 package cmd
 
 import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
 	"nametidy/internal/cleaner"
 	"nametidy/internal/utils"
 
@@ -12,32 +17,305 @@ var historyCmd = &cobra.Command{
 	Short: "Manage rename history",
 }
 
+// sub command: history list
+var historyListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List recorded rename batches",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		verbose, _ := cmd.Flags().GetBool("verbose")
+		since, _ := cmd.Flags().GetString("since")
+		until, _ := cmd.Flags().GetString("until")
+		operation, _ := cmd.Flags().GetString("operation")
+		dirPath, _ := cmd.Flags().GetString("path")
+
+		utils.InitLogger(verbose)
+
+		filter := cleaner.HistoryFilter{Operation: operation, Path: dirPath}
+		var err error
+		if filter.Since, err = parseDate(since, false); err != nil {
+			return usage("Invalid --since value", err)
+		}
+		if filter.Until, err = parseDate(until, true); err != nil {
+			return usage("Invalid --until value", err)
+		}
+
+		db, err := openDB(dirPath)
+		if err != nil {
+			return fatal("Failed to open DB", err)
+		}
+
+		batches, err := cleaner.ListBatches(db, filter)
+		if err != nil {
+			return fatal("Failed to read history", err)
+		}
+		if len(batches) == 0 {
+			fmt.Println("No history found.")
+			return nil
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "BATCH\tOPERATION\tDIRECTORY\tTIME\tFILES\tSTATUS")
+		for _, b := range batches {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%s\n",
+				b.BatchID, b.Operation, b.Directory, b.CreatedAt.Local().Format("2006-01-02 15:04:05"), b.Files, b.Status)
+		}
+		w.Flush()
+		return nil
+	},
+}
+
+// sub command: history show
+var historyShowCmd = &cobra.Command{
+	Use:   "show <batch>",
+	Short: "Show the renames of one batch",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		verbose, _ := cmd.Flags().GetBool("verbose")
+		dirPath, _ := cmd.Flags().GetString("path")
+
+		utils.InitLogger(verbose)
+
+		db, err := openDB(dirPath)
+		if err != nil {
+			return fatal("Failed to open DB", err)
+		}
+
+		batch, err := cleaner.GetBatch(db, args[0])
+		if err != nil {
+			return fatal("Failed to read history", err)
+		}
+
+		fmt.Printf("Batch:     %s\n", batch.ID)
+		fmt.Printf("Operation: %s\n", batch.Operation)
+		fmt.Printf("Status:    %s\n", batch.Status)
+		fmt.Printf("Directory: %s\n", batch.Directory)
+		fmt.Printf("Time:      %s\n", batch.CreatedAt.Local().Format("2006-01-02 15:04:05"))
+		if batch.UndoneAt != nil {
+			fmt.Printf("Undone:    %s\n", batch.UndoneAt.Local().Format("2006-01-02 15:04:05"))
+		}
+		if batch.User != "" || batch.Hostname != "" {
+			fmt.Printf("By:        %s@%s\n", batch.User, batch.Hostname)
+		}
+		if batch.CommandLine != "" {
+			fmt.Printf("Command:   %s\n", batch.CommandLine)
+		}
+		if batch.Options != "" {
+			fmt.Printf("Options:   %s\n", batch.Options)
+		}
+		fmt.Println()
+		for _, h := range batch.Entries {
+			fmt.Printf("%s → %s\n", h.OriginalPath, h.NewPath)
+		}
+		return nil
+	},
+}
+
+// sub command: history export
+var historyExportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export rename history as JSON or CSV",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		verbose, _ := cmd.Flags().GetBool("verbose")
+		format, _ := cmd.Flags().GetString("format")
+		output, _ := cmd.Flags().GetString("output")
+		since, _ := cmd.Flags().GetString("since")
+		until, _ := cmd.Flags().GetString("until")
+		operation, _ := cmd.Flags().GetString("operation")
+		dirPath, _ := cmd.Flags().GetString("path")
+
+		utils.InitLogger(verbose)
+
+		format, err := cleaner.ParseExportFormat(format, output)
+		if err != nil {
+			return usage("Invalid --format value", err)
+		}
+		filter := cleaner.HistoryFilter{Operation: operation, Path: dirPath}
+		if filter.Since, err = parseDate(since, false); err != nil {
+			return usage("Invalid --since value", err)
+		}
+		if filter.Until, err = parseDate(until, true); err != nil {
+			return usage("Invalid --until value", err)
+		}
+
+		db, err := openDB(dirPath)
+		if err != nil {
+			return fatal("Failed to open DB", err)
+		}
+
+		w := os.Stdout
+		if output != "" {
+			if w, err = os.Create(output); err != nil {
+				return fatal("Failed to create output file", err)
+			}
+			defer w.Close()
+		}
+
+		count, err := cleaner.ExportHistory(db, w, format, filter)
+		if err != nil {
+			return fatal("Failed to export history", err)
+		}
+		utils.Info(fmt.Sprintf("Exported %d history entries", count))
+		return nil
+	},
+}
+
+// sub command: history import
+var historyImportCmd = &cobra.Command{
+	Use:   "import <file>",
+	Short: "Import rename history exported by `history export`",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		verbose, _ := cmd.Flags().GetBool("verbose")
+		format, _ := cmd.Flags().GetString("format")
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		dirPath, _ := cmd.Flags().GetString("path")
+
+		utils.InitLogger(verbose)
+
+		format, err := cleaner.ParseExportFormat(format, args[0])
+		if err != nil {
+			return usage("Invalid --format value", err)
+		}
+
+		file, err := os.Open(args[0])
+		if err != nil {
+			return fatal("Failed to open input file", err)
+		}
+		defer file.Close()
+
+		db, err := openDB(dirPath)
+		if err != nil {
+			return fatal("Failed to open DB", err)
+		}
+
+		count, err := cleaner.ImportHistory(db, file, format, dryRun)
+		if err != nil {
+			return fatal("Failed to import history", err)
+		}
+		if dryRun {
+			fmt.Printf("[DRY-RUN] %d history entries are valid and would be imported.\n", count)
+			return nil
+		}
+		fmt.Printf("Imported %d history entries.\n", count)
+		return nil
+	},
+}
+
+// sub command: history prune
+var historyPruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Delete selected rename history records",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		verbose, _ := cmd.Flags().GetBool("verbose")
+		olderThan, _ := cmd.Flags().GetString("older-than")
+		keepLast, _ := cmd.Flags().GetInt("keep-last")
+		batchID, _ := cmd.Flags().GetString("batch")
+		dirPath, _ := cmd.Flags().GetString("path")
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+
+		utils.InitLogger(verbose)
+
+		if olderThan == "" && keepLast < 0 && batchID == "" && dirPath == "" {
+			return usage("Nothing selected", fmt.Errorf("use --older-than, --keep-last, --batch or --path (or `history clear`)"))
+		}
+		age, err := parseAge(olderThan)
+		if err != nil {
+			return usage("Invalid --older-than value", err)
+		}
+
+		db, err := openDB(dirPath)
+		if err != nil {
+			return fatal("Failed to open DB", err)
+		}
+
+		opts := cleaner.PruneOptions{OlderThan: age, KeepLast: keepLast, BatchID: batchID, Path: dirPath}
+		batches, entries, err := cleaner.PruneHistory(db, opts, dryRun)
+		if err != nil {
+			return fatal("Failed to prune history", err)
+		}
+		if dryRun {
+			fmt.Printf("[DRY-RUN] Would delete %d batch(es), %d history entries.\n", batches, entries)
+			return nil
+		}
+		fmt.Printf("Deleted %d batch(es), %d history entries.\n", batches, entries)
+		return nil
+	},
+}
+
 // sub command: history clear
 var historyClearCmd = &cobra.Command{
 	Use:   "clear",
 	Short: "Delete all rename history records",
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		verbose, _ := cmd.Flags().GetBool("verbose")
+		dirPath, _ := cmd.Flags().GetString("path")
 
 		utils.InitLogger(verbose)
 
-		db, err := cleaner.GetDB()
+		db, err := openDB(dirPath)
 		if err != nil {
-			utils.Error("Failed to open DB", err)
-			return
+			return fatal("Failed to open DB", err)
 		}
 
 		if err := cleaner.ClearHistory(db); err != nil {
-			utils.Error("Failed to clear history", err)
-		} else {
-			utils.Info("History cleared")
+			return fatal("Failed to clear history", err)
 		}
+		utils.Info("History cleared")
+		return nil
 	},
 }
 
+// parseDate accepts a date (2006-01-02), a date with time (2006-01-02 15:04)
+// or RFC 3339. A bare date used as an upper bound covers the whole day.
+func parseDate(value string, endOfDay bool) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		if endOfDay {
+			t = t.AddDate(0, 0, 1)
+		}
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02 15:04", value, time.Local); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
 func init() {
+	historyListCmd.Flags().String("since", "", "Only batches created on or after this date (YYYY-MM-DD)")
+	historyListCmd.Flags().String("until", "", "Only batches created on or before this date (YYYY-MM-DD)")
+	historyListCmd.Flags().String("operation", "", "Only batches of this operation (clean, number, ...)")
+	historyListCmd.Flags().StringP("path", "p", "", "Only batches that touched files under this directory")
+	historyListCmd.Flags().BoolP("verbose", "v", false, "Show detailed logs")
+	historyShowCmd.Flags().StringP("path", "p", "", "Target directory (selects the database in --local-db mode)")
+	historyShowCmd.Flags().BoolP("verbose", "v", false, "Show detailed logs")
+	historyExportCmd.Flags().String("format", "", "Output format: json or csv (default: from --output extension, else json)")
+	historyExportCmd.Flags().StringP("output", "o", "", "Write to this file instead of stdout")
+	historyExportCmd.Flags().String("since", "", "Only batches created on or after this date (YYYY-MM-DD)")
+	historyExportCmd.Flags().String("until", "", "Only batches created on or before this date (YYYY-MM-DD)")
+	historyExportCmd.Flags().String("operation", "", "Only batches of this operation (clean, number, ...)")
+	historyExportCmd.Flags().StringP("path", "p", "", "Only batches that touched files under this directory")
+	historyExportCmd.Flags().BoolP("verbose", "v", false, "Show detailed logs")
+	historyImportCmd.Flags().String("format", "", "Input format: json or csv (default: from file extension, else json)")
+	historyImportCmd.Flags().BoolP("dry-run", "d", false, "Only validate the file")
+	historyImportCmd.Flags().StringP("path", "p", "", "Target directory (selects the database in --local-db mode)")
+	historyImportCmd.Flags().BoolP("verbose", "v", false, "Show detailed logs")
+	historyPruneCmd.Flags().String("older-than", "", "Only batches older than this age (e.g. 30d, 2w, 12h)")
+	historyPruneCmd.Flags().Int("keep-last", -1, "Always keep this many of the newest matching batches")
+	historyPruneCmd.Flags().String("batch", "", "Only the batch with this ID")
+	historyPruneCmd.Flags().StringP("path", "p", "", "Only batches that touched files under this directory")
+	historyPruneCmd.Flags().BoolP("dry-run", "d", false, "Show what would be deleted only")
+	historyPruneCmd.Flags().BoolP("verbose", "v", false, "Show detailed logs")
+	historyClearCmd.Flags().StringP("path", "p", "", "Target directory (selects the database in --local-db mode)")
 	historyClearCmd.Flags().BoolP("verbose", "v", false, "Show detailed logs")
 
+	historyCmd.AddCommand(historyListCmd)
+	historyCmd.AddCommand(historyShowCmd)
+	historyCmd.AddCommand(historyExportCmd)
+	historyCmd.AddCommand(historyImportCmd)
+	historyCmd.AddCommand(historyPruneCmd)
 	historyCmd.AddCommand(historyClearCmd)
 	rootCmd.AddCommand(historyCmd)
-}
\ No newline at end of file
+}
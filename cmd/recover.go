@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"nametidy/internal/cleaner"
+	"nametidy/internal/utils"
+
+	"github.com/spf13/cobra"
+)
+
+var recoverCmd = &cobra.Command{
+	Use:   "recover",
+	Short: "Finishes or rolls back a rename batch that was interrupted.",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		finish, _ := cmd.Flags().GetBool("finish")
+		rollback, _ := cmd.Flags().GetBool("rollback")
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		verbose, _ := cmd.Flags().GetBool("verbose")
+		dirPath, _ := cmd.Flags().GetString("path")
+
+		utils.InitLogger(verbose)
+
+		if finish && rollback {
+			return usage("Invalid flags", fmt.Errorf("--finish and --rollback cannot be used together"))
+		}
+
+		db, err := openDB(dirPath)
+		if err != nil {
+			return fatal("Failed to open DB", err)
+		}
+
+		batches, err := cleaner.FindIncompleteBatches(db)
+		if err != nil {
+			return fatal("Failed to read journal", err)
+		}
+		if len(batches) == 0 {
+			return &exitError{code: ExitNothingToDo, msg: "No interrupted batch found"}
+		}
+
+		failures := 0
+
+		for _, b := range batches {
+			fmt.Printf("Interrupted batch %s (%s, %s): %d of %d renames done\n",
+				b.BatchID, b.Operation, b.CreatedAt.Format("2006-01-02 15:04:05"), b.Done, b.Total)
+
+			doFinish := finish
+			if !finish && !rollback {
+				switch prompt("Finish (f), roll back (r) or leave it (n)? ") {
+				case "f", "finish":
+					doFinish = true
+				case "r", "rollback":
+				default:
+					continue
+				}
+			}
+
+			if err := cleaner.Recover(db, b.BatchID, doFinish, dryRun); err != nil {
+				utils.Error("Failed to recover "+b.BatchID, err)
+				failures++
+				continue
+			}
+			if !dryRun {
+				utils.Info("Recovered " + b.BatchID)
+			}
+		}
+		if failures > 0 {
+			code := ExitPartial
+			if failures == len(batches) {
+				code = ExitFatal
+			}
+			return &exitError{code: code, msg: "Recover failed", err: fmt.Errorf("%d of %d interrupted batch(es) could not be recovered", failures, len(batches))}
+		}
+		return nil
+	},
+}
+
+var stdin = bufio.NewReader(os.Stdin)
+
+// prompt asks a question on stdout and returns the trimmed, lower-cased answer
+func prompt(question string) string {
+	fmt.Print(question)
+	answer, _ := stdin.ReadString('\n')
+	return strings.ToLower(strings.TrimSpace(answer))
+}
+
+func init() {
+	recoverCmd.Flags().Bool("finish", false, "Apply the remaining renames of the interrupted batch")
+	recoverCmd.Flags().Bool("rollback", false, "Move the already renamed files back")
+	recoverCmd.Flags().StringP("path", "p", "", "Target directory (selects the database in --local-db mode)")
+	recoverCmd.Flags().BoolP("dry-run", "d", false, "Show rename results only")
+	recoverCmd.Flags().BoolP("verbose", "v", false, "Show detailed logs")
+
+	rootCmd.AddCommand(recoverCmd)
+}
@@ -4,20 +4,47 @@ Copyright © 2025 mi8bi <mi8biiiii@gmail.com>
 package cmd
 
 import (
+	"fmt"
+
 	"nametidy/internal/cleaner"
+
 	"github.com/spf13/cobra"
+	"gorm.io/gorm"
 )
 
 var redoCmd = &cobra.Command{
 	Use:   "redo",
-	Short: "Redoes the most recent rename operation.",
-    Run:   runWithCommonSetup("redo the rename operation", cleaner.Redo),
+	Short: "Redoes the most recently undone rename operations.",
+	RunE:  runWithCommonSetup("redo the rename operation", runRedo),
+}
+
+func runRedo(cmd *cobra.Command, db *gorm.DB, dirPath string, dryRun bool) error {
+	batchID, _ := cmd.Flags().GetString("batch")
+	if batchID != "" {
+		if cmd.Flags().Changed("steps") {
+			return usage("Invalid flags", fmt.Errorf("--batch and --steps cannot be used together"))
+		}
+		force, _ := cmd.Flags().GetBool("force")
+		return cleaner.RedoBatch(db, dirPath, batchID, force, dryRun)
+	}
+
+	if cmd.Flags().Changed("force") {
+		return usage("Invalid flags", fmt.Errorf("--force can only be used with --batch"))
+	}
+	count, _ := cmd.Flags().GetInt("steps")
+	if count < 1 {
+		return usage("Invalid --steps value", fmt.Errorf("must be at least 1, got %d", count))
+	}
+	return cleaner.Redo(db, dirPath, count, dryRun)
 }
 
 func init() {
 	redoCmd.Flags().StringP("path", "p", "", "Path to the target directory")
 	redoCmd.Flags().BoolP("dry-run", "d", false, "Show rename results only")
 	redoCmd.Flags().BoolP("verbose", "v", false, "Show detailed logs")
+	redoCmd.Flags().IntP("steps", "n", 1, "Number of operations to redo")
+	redoCmd.Flags().String("batch", "", "Redo only the batch with this ID")
+	redoCmd.Flags().Bool("force", false, "With --batch, redo even if files moved or later batches touched them")
 	redoCmd.MarkFlagRequired("path")
 
 	rootCmd.AddCommand(redoCmd)
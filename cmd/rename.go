@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"nametidy/internal/cleaner"
+
+	"github.com/spf13/cobra"
+	"gorm.io/gorm"
+)
+
+var renameCmd = &cobra.Command{
+	Use:   "rename",
+	Short: "Renames files from a template such as \"{date}_{name}_{counter:3}{ext}\".",
+	RunE:  runWithCommonSetup("template rename", runRename),
+}
+
+func runRename(cmd *cobra.Command, db *gorm.DB, dirPath string, dryRun bool) error {
+	template, _ := cmd.Flags().GetString("template")
+	planOut, _ := cmd.Flags().GetString("plan-out")
+
+	tmpl, err := cleaner.ParseTemplate(template)
+	if err != nil {
+		return usage("Invalid --template value", err)
+	}
+	policy, err := conflictPolicy(cmd)
+	if err != nil {
+		return usage("Invalid --on-conflict value", err)
+	}
+	return cleaner.RenameFiles(db, dirPath, tmpl, policy, dryRun, planOut)
+}
+
+func init() {
+	renameCmd.Flags().StringP("path", "p", "", "Path to the target directory")
+	renameCmd.Flags().BoolP("dry-run", "d", false, "Show rename results only")
+	addPlanOutFlag(renameCmd)
+	renameCmd.Flags().BoolP("verbose", "v", false, "Show detailed logs")
+	renameCmd.Flags().StringP("template", "t", "", "New name; placeholders: {name} {ext} {parent} {counter:N} {date:layout} {mtime:layout} {ctime:layout} {size} {hash:N}")
+	addConflictFlag(renameCmd, cleaner.ConflictSuffix)
+	renameCmd.MarkFlagRequired("path")
+	renameCmd.MarkFlagRequired("template")
+
+	rootCmd.AddCommand(renameCmd)
+}
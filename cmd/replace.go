@@ -0,0 +1,50 @@
+package cmd
+
+import (
+	"errors"
+	"regexp"
+
+	"nametidy/internal/cleaner"
+
+	"github.com/spf13/cobra"
+	"gorm.io/gorm"
+)
+
+var replaceCmd = &cobra.Command{
+	Use:   "replace",
+	Short: "Renames files with a regular expression.",
+	RunE:  runWithCommonSetup("regex rename", runReplace),
+}
+
+func runReplace(cmd *cobra.Command, db *gorm.DB, dirPath string, dryRun bool) error {
+	from, _ := cmd.Flags().GetString("from")
+	to, _ := cmd.Flags().GetString("to")
+	planOut, _ := cmd.Flags().GetString("plan-out")
+
+	if from == "" {
+		return usage("Invalid --from value", errors.New("the pattern must not be empty"))
+	}
+	re, err := regexp.Compile(from)
+	if err != nil {
+		return usage("Invalid --from value", err)
+	}
+	policy, err := conflictPolicy(cmd)
+	if err != nil {
+		return usage("Invalid --on-conflict value", err)
+	}
+	return cleaner.Replace(db, dirPath, re, to, policy, dryRun, planOut)
+}
+
+func init() {
+	replaceCmd.Flags().StringP("path", "p", "", "Path to the target directory")
+	replaceCmd.Flags().BoolP("dry-run", "d", false, "Show rename results only")
+	addPlanOutFlag(replaceCmd)
+	replaceCmd.Flags().BoolP("verbose", "v", false, "Show detailed logs")
+	replaceCmd.Flags().String("from", "", "Regular expression to search for in file names")
+	replaceCmd.Flags().String("to", "", "Replacement; $1 or ${name} insert capture groups")
+	addConflictFlag(replaceCmd, cleaner.ConflictSuffix)
+	replaceCmd.MarkFlagRequired("path")
+	replaceCmd.MarkFlagRequired("from")
+
+	rootCmd.AddCommand(replaceCmd)
+}
@@ -22,8 +22,13 @@ THE SOFTWARE.
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"os"
+	"strings"
+
+	"nametidy/internal/cleaner"
+	"nametidy/internal/utils"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -44,15 +49,35 @@ to quickly create a Cobra application.`,
 	// Uncomment the following line if your bare application
 	// has an action associated with it:
 	// Run: func(cmd *cobra.Command, args []string) { },
+
+	// Execute reports errors and picks the exit code
+	SilenceErrors: true,
+	SilenceUsage:  true,
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
+// The process exits with one of the Exit* codes.
 func Execute() {
-	err := rootCmd.Execute()
-	if err != nil {
-		os.Exit(1)
+	cmd, err := rootCmd.ExecuteC()
+	if err == nil {
+		return
+	}
+
+	var e *exitError
+	if !errors.As(err, &e) {
+		// Errors not returned by a command come from cobra: unknown
+		// commands or flags, missing arguments, ...
+		utils.Error("Invalid usage", err)
+		fmt.Fprintf(os.Stderr, "Run '%s --help' for usage.\n", cmd.CommandPath())
+		os.Exit(ExitUsage)
 	}
+	if e.code == ExitNothingToDo {
+		utils.Warn(e.Error())
+	} else {
+		utils.Error(e.msg, e.err)
+	}
+	os.Exit(e.code)
 }
 
 func init() {
@@ -63,6 +88,12 @@ func init() {
 	// will be global for your application.
 
 	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.nametidy.yaml)")
+	rootCmd.PersistentFlags().String("db", "", "history database file (default is $HOME/"+cleaner.DB_FILE+")")
+	viper.BindPFlag("db", rootCmd.PersistentFlags().Lookup("db"))
+	rootCmd.PersistentFlags().Bool("local-db", false, "keep history in "+cleaner.LOCAL_DB_DIR+"/ at the target directory")
+	viper.BindPFlag("local_db", rootCmd.PersistentFlags().Lookup("local-db"))
+	rootCmd.PersistentFlags().Bool("hash", false, "record a content hash of renamed files so undo can detect replaced files")
+	viper.BindPFlag("history.hash", rootCmd.PersistentFlags().Lookup("hash"))
 
 	// Cobra also supports local flags, which will only run
 	// when this action is called directly.
@@ -85,10 +116,15 @@ func initConfig() {
 		viper.SetConfigName(".nametidy")
 	}
 
+	// NAMETIDY_DB, NAMETIDY_LOCAL_DB, NAMETIDY_HISTORY_MAX_AGE, ...
+	viper.SetEnvPrefix("nametidy")
+	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
 	viper.AutomaticEnv() // read in environment variables that match
 
 	// If a config file is found, read it in.
 	if err := viper.ReadInConfig(); err == nil {
 		fmt.Fprintln(os.Stderr, "Using config file:", viper.ConfigFileUsed())
 	}
+
+	cleaner.SetContentHashing(viper.GetBool("history.hash"))
 }
@@ -1,20 +1,47 @@
 package cmd
 
 import (
+	"fmt"
+
 	"nametidy/internal/cleaner"
+
 	"github.com/spf13/cobra"
+	"gorm.io/gorm"
 )
 
 var undoCmd = &cobra.Command{
 	Use:   "undo",
-	Short: "Undoes the most recent rename operation.",
-    Run:   runWithCommonSetup("undo the rename operation", cleaner.Undo),
+	Short: "Undoes the most recent rename operations.",
+	RunE:  runWithCommonSetup("undo the rename operation", runUndo),
+}
+
+func runUndo(cmd *cobra.Command, db *gorm.DB, dirPath string, dryRun bool) error {
+	batchID, _ := cmd.Flags().GetString("batch")
+	if batchID != "" {
+		if cmd.Flags().Changed("steps") {
+			return usage("Invalid flags", fmt.Errorf("--batch and --steps cannot be used together"))
+		}
+		force, _ := cmd.Flags().GetBool("force")
+		return cleaner.UndoBatch(db, dirPath, batchID, force, dryRun)
+	}
+
+	if cmd.Flags().Changed("force") {
+		return usage("Invalid flags", fmt.Errorf("--force can only be used with --batch"))
+	}
+	count, _ := cmd.Flags().GetInt("steps")
+	if count < 1 {
+		return usage("Invalid --steps value", fmt.Errorf("must be at least 1, got %d", count))
+	}
+	return cleaner.Undo(db, dirPath, count, dryRun)
 }
 
 func init() {
 	undoCmd.Flags().StringP("path", "p", "", "Path to the target directory")
 	undoCmd.Flags().BoolP("dry-run", "d", false, "Show rename results only")
 	undoCmd.Flags().BoolP("verbose", "v", false, "Show detailed logs")
+	undoCmd.Flags().IntP("steps", "n", 1, "Number of operations to undo")
+	undoCmd.Flags().String("batch", "", "Undo only the batch with this ID")
+	undoCmd.Flags().Bool("force", false, "With --batch, undo even if files moved or later batches touched them")
 	undoCmd.MarkFlagRequired("path")
 
 	rootCmd.AddCommand(undoCmd)
@@ -0,0 +1,191 @@
+package cleaner
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// step is one physical os.Rename. A plan entry normally maps to a single
+// step, but entries that are part of a cycle go through a temporary name.
+type step struct {
+	From   string
+	To     string
+	Source string // the plan entry this step belongs to
+	Target string
+	Final  bool
+}
+
+// stepHook is called after a step has been applied (done == true) or
+// reverted (done == false).
+type stepHook func(i int, done bool) error
+
+// ApplyError reports a batch that could not be applied completely. The renames
+// made before the failure have been reverted; any that could not be reverted
+// are listed in Stuck.
+type ApplyError struct {
+	Err        error
+	RolledBack int
+	Stuck      []string
+}
+
+func (e *ApplyError) Error() string {
+	msg := fmt.Sprintf("%v; rolled back %d rename(s)", e.Err, e.RolledBack)
+	if len(e.Stuck) > 0 {
+		msg += "; could not roll back: " + strings.Join(e.Stuck, ", ")
+	}
+	return msg
+}
+
+func (e *ApplyError) Unwrap() error { return e.Err }
+
+// steps orders the renames so that no file is moved onto a path that another
+// pending rename still has to vacate. Cycles (A→B, B→A) are broken by moving
+// one member to a temporary name first.
+func (p *Plan) steps() []step {
+	type pending struct {
+		index  int
+		source string
+	}
+
+	var queue []pending
+	occupied := make(map[string]bool)
+	for i, e := range p.Entries {
+		if e.Skipped {
+			continue
+		}
+		queue = append(queue, pending{index: i, source: e.Source})
+		occupied[e.Source] = true
+	}
+
+	var steps []step
+	tmpCount := 0
+	for len(queue) > 0 {
+		var rest []pending
+		for _, q := range queue {
+			target := p.Entries[q.index].Target
+			if occupied[target] {
+				rest = append(rest, q)
+				continue
+			}
+			e := p.Entries[q.index]
+			steps = append(steps, step{From: q.source, To: target, Source: e.Source, Target: e.Target, Final: true})
+			delete(occupied, q.source)
+		}
+
+		if len(rest) == len(queue) {
+			// Every remaining rename waits on another one: a cycle.
+			q := &rest[0]
+			tmp := tempPath(q.source, &tmpCount)
+			e := p.Entries[q.index]
+			steps = append(steps, step{From: q.source, To: tmp, Source: e.Source, Target: e.Target})
+			delete(occupied, q.source)
+			q.source = tmp
+		}
+		queue = rest
+	}
+	return steps
+}
+
+// tempPath returns an unused name next to path for parking a file during a
+// cycle.
+func tempPath(path string, count *int) string {
+	dir, file := filepath.Split(path)
+	for {
+		*count++
+		candidate := filepath.Join(dir, fmt.Sprintf(".nametidy-tmp-%d-%s", *count, file))
+		if _, err := os.Lstat(candidate); os.IsNotExist(err) {
+			return candidate
+		}
+	}
+}
+
+// apply performs the renames of the plan on the file system without touching
+// the history. If one of them fails, the renames already made are reverted
+// and an *ApplyError is returned.
+func (p *Plan) apply() error {
+	_, err := runSteps(p.steps(), nil)
+	return err
+}
+
+// Commit applies the plan and records it in the history. Every step is
+// written to the journal before it runs, so an interrupted batch can be
+// finished or rolled back with Recover. If a rename or the history update
+// fails, the renames already made are reverted, so a batch is either fully
+// applied and recorded or not applied at all.
+func (p *Plan) Commit(db *gorm.DB) error {
+	steps := p.steps()
+	if len(steps) == 0 {
+		return db.Transaction(p.record)
+	}
+
+	j, err := openJournal(db, p, steps)
+	if err != nil {
+		return err
+	}
+
+	done, err := runSteps(steps, j.mark)
+	if err != nil {
+		p.recordFailure(db)
+		return j.close(err)
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := p.record(tx); err != nil {
+			return err
+		}
+		return j.clear(tx)
+	})
+	if err != nil {
+		err = j.close(rollback(steps, done, fmt.Errorf("failed to record history: %v", err), j.mark))
+		p.recordFailure(db)
+		return err
+	}
+	return nil
+}
+
+// runSteps executes steps in order and returns the indexes of the ones that
+// were applied. On failure everything applied so far is rolled back.
+func runSteps(steps []step, hook stepHook) ([]int, error) {
+	var done []int
+	for i, s := range steps {
+		if err := os.Rename(s.From, s.To); err != nil {
+			return nil, rollback(steps, done, fmt.Errorf("failed to rename %s → %s: %v", s.Source, s.Target, err), hook)
+		}
+		done = append(done, i)
+		if s.Final {
+			fmt.Printf("Renamed: %s → %s\n", displayPath(s.Source), displayPath(s.Target))
+		}
+		if hook != nil {
+			if err := hook(i, true); err != nil {
+				return nil, rollback(steps, done, fmt.Errorf("failed to update journal: %v", err), hook)
+			}
+		}
+	}
+	return done, nil
+}
+
+// rollback reverts the given steps in reverse order and wraps cause into an
+// *ApplyError describing the outcome.
+func rollback(steps []step, done []int, cause error, hook stepHook) error {
+	result := &ApplyError{Err: cause}
+	for k := len(done) - 1; k >= 0; k-- {
+		i := done[k]
+		s := steps[i]
+		if err := os.Rename(s.To, s.From); err != nil {
+			result.Stuck = append(result.Stuck, fmt.Sprintf("%s (expected at %s)", s.To, s.From))
+			continue
+		}
+		result.RolledBack++
+		if s.Final {
+			fmt.Printf("Rolled back: %s → %s\n", displayPath(s.Target), displayPath(s.Source))
+		}
+		if hook != nil {
+			hook(i, false)
+		}
+	}
+	return result
+}
@@ -0,0 +1,59 @@
+package cleaner
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestApplyRollsBackOnRenameFailure(t *testing.T) {
+	dir := t.TempDir()
+	createFiles(t, dir, "a.txt", "b.txt")
+	a, b := filepath.Join(dir, "a.txt"), filepath.Join(dir, "b.txt")
+
+	plan := NewPlan("test", dir)
+	plan.Add(a, filepath.Join(dir, "a2.txt"), "")
+	plan.Add(b, filepath.Join(dir, "missing", "b.txt"), "")
+
+	err := plan.apply()
+	var applyErr *ApplyError
+	if !errors.As(err, &applyErr) {
+		t.Fatalf("expected *ApplyError, got %v", err)
+	}
+	if applyErr.RolledBack != 1 || len(applyErr.Stuck) != 0 {
+		t.Errorf("unexpected rollback result: %+v", applyErr)
+	}
+	for _, path := range []string{a, b} {
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("%s should be restored: %v", path, err)
+		}
+	}
+}
+
+func TestCommitRollsBackOnRecordFailure(t *testing.T) {
+	db := setupTestDB(t)
+	dir := t.TempDir()
+	createFiles(t, dir, "a b.txt")
+
+	plan, err := PlanClean(dir, nil, ConflictSuffix)
+	if err != nil {
+		t.Fatalf("PlanClean failed: %v", err)
+	}
+	// Without the history table the batch cannot be recorded.
+	if err := db.Migrator().DropTable(&RenameHistory{}); err != nil {
+		t.Fatalf("failed to drop table: %v", err)
+	}
+	if err := plan.Commit(db); err == nil {
+		t.Fatal("expected Commit to fail")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "a b.txt")); err != nil {
+		t.Errorf("rename should be rolled back: %v", err)
+	}
+
+	var count int64
+	db.Model(&JournalEntry{}).Count(&count)
+	if count != 0 {
+		t.Errorf("expected the journal to be cleared after rollback, got %d entries", count)
+	}
+}
@@ -1,59 +1,66 @@
 package cleaner
 
 import (
-	"nametidy/internal/utils"
-	"fmt"
 	"os"
 	"path/filepath"
-	"time"
+
+	"nametidy/internal/rules"
 
 	"gorm.io/gorm"
 )
 
-func Clean(db *gorm.DB, dirPath string, dryRun bool) error {
-	batchID := fmt.Sprintf("clean-%d", time.Now().UnixNano())
-	histories := []RenameHistory{}
+func Clean(db *gorm.DB, dirPath string, pipeline *rules.Pipeline, policy ConflictPolicy, dryRun bool, planOut string) error {
+	plan, err := PlanClean(dirPath, pipeline, policy)
+	if err != nil {
+		return err
+	}
+	return execute(db, plan, dryRun, planOut)
+}
+
+// PlanClean builds the rename plan for cleaning every file name under dirPath
+// with the rules of pipeline. A nil pipeline uses the default profile.
+func PlanClean(dirPath string, pipeline *rules.Pipeline, policy ConflictPolicy) (*Plan, error) {
+	root, err := absPath(dirPath)
+	if err != nil {
+		return nil, err
+	}
+	if pipeline == nil {
+		pipeline = rules.Default()
+	}
+	plan := NewPlan("clean", root)
+	plan.Options = map[string]string{"profile": pipeline.Name, "on_conflict": string(policy)}
 
-	err := filepath.Walk(dirPath, func(path string, info os.FileInfo, err error) error {
+	err = filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
 
 		if info.IsDir() {
+			if info.Name() == LOCAL_DB_DIR {
+				return filepath.SkipDir
+			}
 			return nil
 		}
 
-		oldName := info.Name()
-		newName := utils.CleanFileName(oldName)
-
-		if oldName != newName {
-			newPath := filepath.Join(filepath.Dir(path), newName)
-			if dryRun {
-				fmt.Printf("[DRY-RUN] %s → %s\n", path, newPath)
-			} else {
-				if err := os.Rename(path, newPath); err != nil {
-					utils.Error("Rename failed", err)
-					return err
-				}
-				fmt.Printf("Renamed: %s → %s\n", path, newPath)
-				histories = append(histories, RenameHistory{
-					OriginalPath: path,
-					NewPath:      newPath,
-					Operation:    "clean",
-					BatchID:      batchID,
-					CreatedAt:    time.Now(),
-				})
-			}
-		}
+		plan.AddName(path, pipeline.Clean(info.Name()), "clean file name ("+pipeline.Name+")")
 		return nil
 	})
-
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	if err := plan.Resolve(policy); err != nil {
+		return nil, err
 	}
+	return plan, nil
+}
 
-	if !dryRun && len(histories) > 0 {
-		return db.Create(&histories).Error
+// absPath returns the absolute, cleaned form of path. History and plans only
+// store such paths so they can be matched regardless of the working directory.
+func absPath(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
 	}
-	return nil
+	return filepath.Clean(abs), nil
 }
\ No newline at end of file
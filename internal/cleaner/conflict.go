@@ -0,0 +1,140 @@
+package cleaner
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"nametidy/internal/utils"
+)
+
+// ConflictPolicy decides what happens when a planned rename would land on a
+// name that is already taken.
+type ConflictPolicy string
+
+const (
+	// ConflictSkip leaves the conflicting file untouched.
+	ConflictSkip ConflictPolicy = "skip"
+	// ConflictSuffix appends _1, _2, ... to the target until it is free.
+	ConflictSuffix ConflictPolicy = "suffix"
+	// ConflictAbort cancels the whole operation before anything is renamed.
+	ConflictAbort ConflictPolicy = "abort"
+)
+
+// ParseConflictPolicy converts a flag value into a ConflictPolicy
+func ParseConflictPolicy(s string) (ConflictPolicy, error) {
+	switch p := ConflictPolicy(strings.ToLower(s)); p {
+	case ConflictSkip, ConflictSuffix, ConflictAbort:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown conflict policy %q (expected skip, suffix or abort)", s)
+}
+
+// Resolve checks every target against the files on disk and against the
+// targets claimed earlier in the plan, and applies the policy. A target that
+// is currently occupied by the source of another rename is not a conflict,
+// since that file moves away first (or through a temporary name for cycles).
+func (p *Plan) Resolve(policy ConflictPolicy) error {
+	// Skipping an entry keeps its source in place, which can turn an earlier
+	// decision into a conflict, so repeat until nothing changes.
+	for {
+		changed, err := p.resolveOnce(policy)
+		if err != nil || !changed {
+			return err
+		}
+	}
+}
+
+func (p *Plan) resolveOnce(policy ConflictPolicy) (bool, error) {
+	moving := make(map[string]bool)
+	for _, e := range p.Entries {
+		if !e.Skipped {
+			moving[e.Source] = true
+		}
+	}
+
+	claimed := make(map[string]bool)
+	changed := false
+	for i := range p.Entries {
+		e := &p.Entries[i]
+		if e.Skipped {
+			continue
+		}
+
+		conflict := takenBy(e.Target, e.Source, claimed, moving, p.moves)
+		if conflict == "" {
+			claimed[e.Target] = true
+			continue
+		}
+
+		// A directory holding the source has no free variant next to the source
+		action := policy
+		if action == ConflictSuffix && utils.IsWithin(e.Target, e.Source) {
+			action = ConflictSkip
+		}
+
+		switch action {
+		case ConflictAbort:
+			return false, fmt.Errorf("conflict: %s → %s (%s)", e.Source, e.Target, conflict)
+		case ConflictSkip:
+			utils.Warn(fmt.Sprintf("Skipped: %s → %s (%s)", displayPath(e.Source), displayPath(e.Target), conflict))
+			e.Conflicts = append(e.Conflicts, conflict)
+			e.Skipped = true
+		default:
+			target := suffixedPath(e.Target, e.Source, claimed, moving, p.moves)
+			utils.Warn(fmt.Sprintf("Conflict: %s → %s, using %s", displayPath(e.Source), displayPath(e.Target), filepath.Base(target)))
+			e.Conflicts = append(e.Conflicts, fmt.Sprintf("%s: %s", conflict, e.Target))
+			e.Target = target
+			claimed[target] = true
+		}
+		changed = true
+	}
+	return changed, nil
+}
+
+// takenBy describes why target cannot be used by source, or returns an empty
+// string when it is free. Paths on disk are looked up through moves.
+func takenBy(target, source string, claimed, moving map[string]bool, moves dryRunMoves) string {
+	if utils.IsWithin(target, source) {
+		return "target is a directory holding the source"
+	}
+	if claimed[target] {
+		return "target is used by another rename"
+	}
+	if moving[target] {
+		return ""
+	}
+	current := moves.locate(target)
+	if current == "" {
+		return ""
+	}
+	targetInfo, err := os.Lstat(current)
+	if err != nil {
+		return ""
+	}
+	// On case-insensitive file systems "A.txt" → "a.txt" points at itself.
+	if sourceInfo, err := os.Lstat(moves.locate(source)); err == nil && os.SameFile(sourceInfo, targetInfo) {
+		return ""
+	}
+	return "target already exists"
+}
+
+// suffixedPath returns the first free variant of target with _1, _2, ...
+// inserted before the extension, in the directory of target. It returns an
+// empty string when target is a directory holding the source, whose variants
+// would lie outside of it.
+func suffixedPath(target, source string, claimed, moving map[string]bool, moves dryRunMoves) string {
+	if utils.IsWithin(target, source) {
+		return ""
+	}
+	dir, file := filepath.Split(target)
+	ext := filepath.Ext(file)
+	base := file[:len(file)-len(ext)]
+	for i := 1; ; i++ {
+		candidate := filepath.Join(dir, fmt.Sprintf("%s_%d%s", base, i, ext))
+		if takenBy(candidate, source, claimed, moving, moves) == "" && !moving[candidate] {
+			return candidate
+		}
+	}
+}
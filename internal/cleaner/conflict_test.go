@@ -0,0 +1,149 @@
+package cleaner
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func createFiles(t *testing.T, dir string, names ...string) {
+	t.Helper()
+	for _, name := range names {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(name), 0644); err != nil {
+			t.Fatalf("failed to create %s: %v", name, err)
+		}
+	}
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read %s: %v", path, err)
+	}
+	return string(data)
+}
+
+func TestCleanConflictSuffix(t *testing.T) {
+	db := setupTestDB(t)
+	dir := t.TempDir()
+	createFiles(t, dir, "a b.txt", "a!b.txt", "a_b.txt")
+
+	if err := Clean(db, dir, nil, ConflictSuffix, false, ""); err != nil {
+		t.Fatalf("Clean failed: %v", err)
+	}
+
+	expected := map[string]string{
+		"a_b.txt":   "a_b.txt",
+		"a_b_1.txt": "a b.txt",
+		"a_b_2.txt": "a!b.txt",
+	}
+	for name, content := range expected {
+		if got := readFile(t, filepath.Join(dir, name)); got != content {
+			t.Errorf("%s: expected content %q, got %q", name, content, got)
+		}
+	}
+}
+
+func TestCleanConflictSkip(t *testing.T) {
+	db := setupTestDB(t)
+	dir := t.TempDir()
+	createFiles(t, dir, "a b.txt", "a_b.txt")
+
+	// Nothing is left to rename, which is reported like an empty plan.
+	if err := Clean(db, dir, nil, ConflictSkip, false, ""); !errors.Is(err, ErrNothingToDo) {
+		t.Fatalf("expected ErrNothingToDo, got %v", err)
+	}
+
+	if got := readFile(t, filepath.Join(dir, "a_b.txt")); got != "a_b.txt" {
+		t.Errorf("existing file was overwritten, content %q", got)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "a b.txt")); err != nil {
+		t.Errorf("skipped file should keep its name: %v", err)
+	}
+}
+
+func TestCleanConflictAbort(t *testing.T) {
+	db := setupTestDB(t)
+	dir := t.TempDir()
+	createFiles(t, dir, "a b.txt", "a!b.txt", "x y.txt")
+
+	if err := Clean(db, dir, nil, ConflictAbort, false, ""); err == nil {
+		t.Fatal("expected Clean to abort on conflict")
+	}
+
+	for _, name := range []string{"a b.txt", "a!b.txt", "x y.txt"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("%s should not be renamed after abort: %v", name, err)
+		}
+	}
+}
+
+func TestParseConflictPolicy(t *testing.T) {
+	if p, err := ParseConflictPolicy("SKIP"); err != nil || p != ConflictSkip {
+		t.Errorf("expected skip, got %q (%v)", p, err)
+	}
+	if _, err := ParseConflictPolicy("overwrite"); err == nil {
+		t.Error("expected error for unknown policy")
+	}
+}
+
+func TestCleanSkipsEmptyNames(t *testing.T) {
+	db := setupTestDB(t)
+	parent := t.TempDir()
+	dir := filepath.Join(parent, "photos")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	createFiles(t, dir, "---", "a b.txt")
+
+	if err := Clean(db, dir, nil, ConflictSuffix, false, ""); err != nil {
+		t.Fatalf("Clean failed: %v", err)
+	}
+	for _, name := range []string{"---", "a_b.txt"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("expected %s to exist: %v", name, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(parent, "photos_1")); err == nil {
+		t.Error("a file was moved out of the target directory")
+	}
+}
+
+func TestCleanSkipsNamesWithoutStem(t *testing.T) {
+	db := setupTestDB(t)
+	dir := t.TempDir()
+	createFiles(t, dir, "Москва.jpg", "Ελλάδα.jpg", "a b.jpg")
+
+	if err := Clean(db, dir, nil, ConflictSuffix, false, ""); err != nil {
+		t.Fatalf("Clean failed: %v", err)
+	}
+	for _, name := range []string{"Москва.jpg", "Ελλάδα.jpg", "a_b.jpg"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("expected %s to exist: %v", name, err)
+		}
+	}
+	for _, name := range []string{".jpg", "_1.jpg"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+			t.Errorf("%s should not have been created", name)
+		}
+	}
+}
+
+func TestSuffixStaysInSourceDirectory(t *testing.T) {
+	dir := t.TempDir()
+	createFiles(t, dir, "a.txt")
+	source := filepath.Join(dir, "a.txt")
+
+	// A target that is the directory holding the source is never suffixed
+	// into a sibling of that directory.
+	plan := NewPlan("test", dir)
+	plan.Add(source, dir, "")
+	if err := plan.Resolve(ConflictSuffix); err != nil {
+		t.Fatalf("Resolve failed: %v", err)
+	}
+	if len(plan.Renames()) != 0 {
+		t.Errorf("expected the rename to be skipped, got %+v", plan.Renames())
+	}
+}
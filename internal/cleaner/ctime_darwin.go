@@ -0,0 +1,16 @@
+package cleaner
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+// creationTime returns the birth time of the file
+func creationTime(info os.FileInfo) time.Time {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return info.ModTime()
+	}
+	return time.Unix(st.Birthtimespec.Sec, st.Birthtimespec.Nsec)
+}
@@ -0,0 +1,17 @@
+package cleaner
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+// creationTime returns the last status change of the file: stat(2) on Linux
+// has no creation time.
+func creationTime(info os.FileInfo) time.Time {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return info.ModTime()
+	}
+	return time.Unix(int64(st.Ctim.Sec), int64(st.Ctim.Nsec))
+}
@@ -0,0 +1,14 @@
+//go:build !linux && !darwin && !windows
+
+package cleaner
+
+import (
+	"os"
+	"time"
+)
+
+// creationTime falls back to the modification time where nametidy does not
+// know how to read the creation time
+func creationTime(info os.FileInfo) time.Time {
+	return info.ModTime()
+}
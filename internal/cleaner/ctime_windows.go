@@ -0,0 +1,16 @@
+package cleaner
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+// creationTime returns the creation time of the file
+func creationTime(info os.FileInfo) time.Time {
+	attrs, ok := info.Sys().(*syscall.Win32FileAttributeData)
+	if !ok {
+		return info.ModTime()
+	}
+	return time.Unix(0, attrs.CreationTime.Nanoseconds())
+}
@@ -7,78 +7,215 @@ import (
 	"path/filepath"
 	"time"
 
+	"nametidy/internal/utils"
+
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 )
 
 const DB_FILE = ".name_tidy_history.db"
 
+// LOCAL_DB_DIR and LOCAL_DB_FILE make up the per-project database
+// (<root>/.nametidy/history.db) used in local mode
+const (
+	LOCAL_DB_DIR  = ".nametidy"
+	LOCAL_DB_FILE = "history.db"
+)
+
+// Batch statuses
+const (
+	StatusApplied = "applied" // renamed and recorded
+	StatusUndone  = "undone"  // reverted by undo
+	StatusRedone  = "redone"  // re-applied by redo after an undo
+	StatusPartial = "partial" // undo or redo could only move some of the files; see RenameHistory.State
+	StatusFailed  = "failed"  // failed and rolled back; has no entries
+)
+
+// Batch is one rename operation. It owns its entries and records how and
+// where it was run.
+type Batch struct {
+	ID          string `gorm:"primaryKey"`
+	Operation   string // "clean", "number", "replace", "rename", "edit" または "apply"
+	Status      string `gorm:"index"`
+	Directory   string
+	CommandLine string
+	Options     string // JSON
+	User        string
+	Hostname    string
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	UndoneAt    *time.Time      // 最後に undo された日時 (redo の順序に使う)
+	Entries     []RenameHistory `gorm:"foreignKey:BatchID"`
+}
+
+// RenameHistory is a single rename of a Batch. State tells where the file is
+// now: StatusApplied (at NewPath) or StatusUndone (at OriginalPath). The
+// fingerprint describes the file as it was right after the rename.
 type RenameHistory struct {
-	ID            uint      `gorm:"primaryKey"`
-	OriginalPath  string
-	NewPath       string
-	Operation     string // "clean" または "number"
-	BatchID       string
-	CreatedAt     time.Time
-	Reverted      bool
-	Redone        bool
-	OperationType string // "undo" または "redo"
-}
-
-func GetDB() (*gorm.DB, error) {
+	ID           uint   `gorm:"primaryKey"`
+	BatchID      string `gorm:"index"`
+	OriginalPath string
+	NewPath      string
+	State        string `gorm:"not null;default:'applied'"`
+	Fingerprint
+}
+
+// DefaultDBPath returns the history database in the home directory
+func DefaultDBPath() (string, error) {
 	homeDir, err := os.UserHomeDir()
 	if err != nil {
+		return "", err
+	}
+	return filepath.Join(homeDir, DB_FILE), nil
+}
+
+// FindLocalDBPath looks for a .nametidy directory in dir and its parents and
+// returns the database inside the nearest one. If there is none, the path
+// inside dir itself is returned so a new project database is created there.
+func FindLocalDBPath(dir string) (string, error) {
+	start, err := absPath(dir)
+	if err != nil {
+		return "", err
+	}
+	for d := start; ; {
+		if info, err := os.Stat(filepath.Join(d, LOCAL_DB_DIR)); err == nil && info.IsDir() {
+			return filepath.Join(d, LOCAL_DB_DIR, LOCAL_DB_FILE), nil
+		}
+		parent := filepath.Dir(d)
+		if parent == d {
+			break
+		}
+		d = parent
+	}
+	return filepath.Join(start, LOCAL_DB_DIR, LOCAL_DB_FILE), nil
+}
+
+// OpenDB opens (and creates if needed) the history database at dbPath without
+// touching its schema
+func OpenDB(dbPath string) (*gorm.DB, error) {
+	if err := os.MkdirAll(filepath.Dir(dbPath), 0755); err != nil {
 		return nil, err
 	}
-	dbPath := filepath.Join(homeDir, DB_FILE)
-	db, err := gorm.Open(sqlite.Open(dbPath), &gorm.Config{})
+	return gorm.Open(sqlite.Open(dbPath), &gorm.Config{})
+}
+
+// GetDB opens the history database at dbPath and brings its schema up to date
+func GetDB(dbPath string) (*gorm.DB, error) {
+	db, err := OpenDB(dbPath)
 	if err != nil {
 		return nil, err
 	}
-	if err := db.AutoMigrate(&RenameHistory{}); err != nil {
+	if _, err := Migrate(db, false); err != nil {
 		return nil, err
 	}
 	return db, nil
 }
 
 func SaveRenameHistory(db *gorm.DB, entries map[string]string, operation string) error {
-	batchID := fmt.Sprintf("%d", time.Now().UnixNano())
-	var records []RenameHistory
+	batch := Batch{
+		ID:        fmt.Sprintf("%s-%d", operation, time.Now().UnixNano()),
+		Operation: operation,
+		Status:    StatusApplied,
+	}
 	for oldPath, newPath := range entries {
-		records = append(records, RenameHistory{
-			OriginalPath: oldPath,
-			NewPath:      newPath,
-			Operation:    operation,
-			BatchID:      batchID,
-			CreatedAt:    time.Now(),
-			Reverted:     false,
-			Redone:       false,
-		})
+		batch.Entries = append(batch.Entries, RenameHistory{OriginalPath: oldPath, NewPath: newPath})
 	}
-	return db.Create(&records).Error
+	return db.Create(&batch).Error
+}
+
+// undoableStatuses are the states in which a batch still has renamed files
+var undoableStatuses = []string{StatusApplied, StatusRedone, StatusPartial}
+
+// redoableStatuses are the states in which a batch has files that were
+// renamed back by undo
+var redoableStatuses = []string{StatusUndone, StatusPartial}
+
+// GetUndoableBatches returns up to limit batch IDs under root that can be
+// undone, newest first. An empty root matches every batch.
+func GetUndoableBatches(db *gorm.DB, root string, limit int) ([]string, error) {
+	return scopedBatches(db, root, undoableStatuses, "created_at desc", limit)
+}
+
+// GetRedoableBatches returns up to limit batch IDs under root that can be
+// redone, most recently undone first. An empty root matches every batch.
+func GetRedoableBatches(db *gorm.DB, root string, limit int) ([]string, error) {
+	return scopedBatches(db, root, redoableStatuses, "undone_at desc, created_at desc", limit)
+}
+
+// GetBatch loads a batch with its entries
+func GetBatch(db *gorm.DB, batchID string) (*Batch, error) {
+	var batch Batch
+	if err := db.Preload("Entries", func(tx *gorm.DB) *gorm.DB { return tx.Order("id") }).Where("id = ?", batchID).Take(&batch).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("batch %s not found", batchID)
+		}
+		return nil, err
+	}
+	return &batch, nil
+}
+
+// scopedBatches returns the IDs of batches in one of the given states whose
+// paths all lie under root, in the given order
+func scopedBatches(db *gorm.DB, root string, statuses []string, order string, limit int) ([]string, error) {
+	var batches []Batch
+	if err := db.Preload("Entries").Where("status IN ?", statuses).Order(order).Find(&batches).Error; err != nil {
+		return nil, err
+	}
+
+	scoped := []string{}
+	for _, b := range batches {
+		if len(scoped) < limit && batchWithin(root, &b) {
+			scoped = append(scoped, b.ID)
+		}
+	}
+	return scoped, nil
+}
+
+// batchWithin reports whether every entry of the batch lies under root
+func batchWithin(root string, b *Batch) bool {
+	for _, h := range b.Entries {
+		if !historyWithin(root, h) {
+			return false
+		}
+	}
+	return true
+}
+
+// historyWithin reports whether both paths of a record lie under root
+func historyWithin(root string, h RenameHistory) bool {
+	if root == "" {
+		return true
+	}
+	return storedWithin(root, h.OriginalPath) && storedWithin(root, h.NewPath)
+}
+
+// storedWithin reports whether a path read from the history lies under root.
+// Older versions stored paths as given on the command line, so they are
+// resolved against the working directory first.
+func storedWithin(root, path string) bool {
+	abs, err := absPath(path)
+	return err == nil && utils.IsWithin(root, abs)
 }
 
 func GetLastUndoableBatch(db *gorm.DB) (string, error) {
-	var last RenameHistory
-	if err := db.Where("reverted = ? AND redone = ?", false, false).
-			Order("created_at desc").First(&last).Error; err != nil {
+	ids, err := GetUndoableBatches(db, "", 1)
+	if err != nil || len(ids) == 0 {
 		return "", errors.New("no operation to undo")
 	}
-	return last.BatchID, nil
+	return ids[0], nil
 }
 
 func GetLastRedoableBatch(db *gorm.DB) (string, error) {
-	var last RenameHistory
-	if err := db.Where("reverted = ? AND redone = ?", true, false).
-			Order("created_at desc").First(&last).Error; err != nil {
+	ids, err := GetRedoableBatches(db, "", 1)
+	if err != nil || len(ids) == 0 {
 		return "", errors.New("no operation to redo")
 	}
-	return last.BatchID, nil
+	return ids[0], nil
 }
 
 func GetHistoriesByBatch(db *gorm.DB, batchID string) ([]RenameHistory, error) {
 	var records []RenameHistory
-	if err := db.Where("batch_id = ?", batchID).Find(&records).Error; err != nil {
+	if err := db.Where("batch_id = ?", batchID).Order("id").Find(&records).Error; err != nil {
 		return nil, err
 	}
 	return records, nil
@@ -0,0 +1,47 @@
+package cleaner
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFindLocalDBPath(t *testing.T) {
+	root := t.TempDir()
+	sub := filepath.Join(root, "a", "b")
+	if err := os.MkdirAll(sub, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// Without a .nametidy directory anywhere the database goes into dir itself.
+	path, err := FindLocalDBPath(sub)
+	if err != nil {
+		t.Fatalf("FindLocalDBPath failed: %v", err)
+	}
+	if expected := filepath.Join(sub, LOCAL_DB_DIR, LOCAL_DB_FILE); path != expected {
+		t.Errorf("expected %s, got %s", expected, path)
+	}
+
+	// The nearest parent holding one is used instead.
+	if err := os.Mkdir(filepath.Join(root, LOCAL_DB_DIR), 0755); err != nil {
+		t.Fatal(err)
+	}
+	path, err = FindLocalDBPath(sub)
+	if err != nil {
+		t.Fatalf("FindLocalDBPath failed: %v", err)
+	}
+	if expected := filepath.Join(root, LOCAL_DB_DIR, LOCAL_DB_FILE); path != expected {
+		t.Errorf("expected %s, got %s", expected, path)
+	}
+
+	if err := os.Mkdir(filepath.Join(sub, LOCAL_DB_DIR), 0755); err != nil {
+		t.Fatal(err)
+	}
+	path, err = FindLocalDBPath(sub)
+	if err != nil {
+		t.Fatalf("FindLocalDBPath failed: %v", err)
+	}
+	if expected := filepath.Join(sub, LOCAL_DB_DIR, LOCAL_DB_FILE); path != expected {
+		t.Errorf("expected %s, got %s", expected, path)
+	}
+}
@@ -0,0 +1,150 @@
+package cleaner
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"nametidy/internal/utils"
+
+	"gorm.io/gorm"
+)
+
+// EditorFunc lets the user edit the file at path and returns once they are
+// done
+type EditorFunc func(path string) error
+
+// Edit writes the file names under dirPath to a temporary file, one per line,
+// hands it to editor and renames every file whose line was changed. When the
+// edited list is invalid the temporary file is kept so the edits are not lost.
+func Edit(db *gorm.DB, dirPath string, editor EditorFunc, policy ConflictPolicy, dryRun bool, planOut string) error {
+	root, err := absPath(dirPath)
+	if err != nil {
+		return err
+	}
+	original, err := listFiles(root)
+	if err != nil {
+		return err
+	}
+	if len(original) == 0 {
+		return fmt.Errorf("%w: no file under %s", ErrNothingToDo, displayPath(root))
+	}
+
+	f, err := os.CreateTemp("", "nametidy-edit-*.txt")
+	if err != nil {
+		return err
+	}
+	listPath := f.Name()
+	_, err = f.WriteString(strings.Join(original, "\n") + "\n")
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(listPath)
+		return err
+	}
+
+	if err := editor(listPath); err != nil {
+		os.Remove(listPath)
+		return fmt.Errorf("editor failed: %w", err)
+	}
+	edited, err := readLines(listPath)
+	if err != nil {
+		os.Remove(listPath)
+		return err
+	}
+
+	plan, err := PlanEdit(root, original, edited, policy)
+	if err != nil {
+		return fmt.Errorf("%w (your edits are kept in %s)", err, listPath)
+	}
+	os.Remove(listPath)
+	return execute(db, plan, dryRun, planOut)
+}
+
+// PlanEdit builds the rename plan from the file list given to the editor
+// (paths relative to root) and the edited list, matched line by line
+func PlanEdit(root string, original, edited []string, policy ConflictPolicy) (*Plan, error) {
+	if len(edited) != len(original) {
+		return nil, fmt.Errorf("the list has %d lines but %d files were listed; lines must not be added or removed", len(edited), len(original))
+	}
+
+	plan := NewPlan("edit", root)
+	plan.Options = map[string]string{"on_conflict": string(policy)}
+	seen := make(map[string]int, len(edited))
+	for i, line := range edited {
+		if line == "" {
+			return nil, fmt.Errorf("line %d is empty", i+1)
+		}
+		if filepath.IsAbs(line) {
+			return nil, fmt.Errorf("line %d: %s must be relative to %s", i+1, line, root)
+		}
+		target := filepath.Join(root, line)
+		if !withinRoot(root, target) {
+			return nil, fmt.Errorf("line %d: %s is outside %s", i+1, line, root)
+		}
+		if prev, ok := seen[target]; ok {
+			return nil, fmt.Errorf("lines %d and %d both rename to %s", prev, i+1, line)
+		}
+		seen[target] = i + 1
+		if dir := filepath.Dir(target); !utils.IsDirectory(dir) {
+			return nil, fmt.Errorf("line %d: directory %s does not exist", i+1, filepath.Dir(line))
+		}
+		plan.Add(filepath.Join(root, original[i]), target, "edited")
+	}
+
+	if err := plan.Resolve(policy); err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+// listFiles returns the files under root relative to it, in walk order
+func listFiles(root string) ([]string, error) {
+	var files []string
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() {
+			if info.Name() == LOCAL_DB_DIR {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		if strings.ContainsAny(rel, "\r\n") {
+			return fmt.Errorf("cannot edit %q: its name contains a line break", rel)
+		}
+		files = append(files, rel)
+		return nil
+	})
+	return files, err
+}
+
+// readLines reads the edited list, accepting CRLF line endings and ignoring
+// blank lines at the end
+func readLines(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lines = append(lines, strings.TrimSuffix(scanner.Text(), "\r"))
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines, scanner.Err()
+}
@@ -0,0 +1,100 @@
+package cleaner
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// rewriteList returns an editor that replaces the listed names with lines,
+// written with CRLF endings and a trailing blank line
+func rewriteList(lines ...string) EditorFunc {
+	return func(path string) error {
+		return os.WriteFile(path, []byte(strings.Join(lines, "\r\n")+"\r\n\r\n"), 0644)
+	}
+}
+
+func TestEditRenamesChangedLines(t *testing.T) {
+	db := setupTestDB(t)
+	dir := t.TempDir()
+	createFiles(t, dir, "a.txt", "b.txt", "c.txt")
+	if err := os.Mkdir(filepath.Join(dir, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// Swap a and b, move c into sub.
+	if err := Edit(db, dir, rewriteList("b.txt", "a.txt", "sub/c.txt"), ConflictAbort, false, ""); err != nil {
+		t.Fatalf("Edit failed: %v", err)
+	}
+	expected := map[string]string{"a.txt": "b.txt", "b.txt": "a.txt", "sub/c.txt": "c.txt"}
+	for name, content := range expected {
+		if got := readFile(t, filepath.Join(dir, name)); got != content {
+			t.Errorf("%s: expected content %q, got %q", name, content, got)
+		}
+	}
+
+	if err := Undo(db, dir, 1, false); err != nil {
+		t.Fatalf("Undo failed: %v", err)
+	}
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		if got := readFile(t, filepath.Join(dir, name)); got != name {
+			t.Errorf("%s: expected content %q after undo, got %q", name, name, got)
+		}
+	}
+}
+
+func TestEditUnchangedList(t *testing.T) {
+	db := setupTestDB(t)
+	dir := t.TempDir()
+	createFiles(t, dir, "a.txt")
+
+	unchanged := func(string) error { return nil }
+	if err := Edit(db, dir, unchanged, ConflictAbort, false, ""); !errors.Is(err, ErrNothingToDo) {
+		t.Errorf("expected ErrNothingToDo, got %v", err)
+	}
+}
+
+func TestEditValidation(t *testing.T) {
+	dir := t.TempDir()
+	original := []string{"a.txt", "b.txt"}
+	createFiles(t, dir, original...)
+
+	tests := map[string]struct {
+		edited  []string
+		message string
+	}{
+		"line removed": {[]string{"a.txt"}, "must not be added or removed"},
+		"duplicate":    {[]string{"c.txt", "c.txt"}, "lines 1 and 2 both rename to c.txt"},
+		"empty":        {[]string{"", "b.txt"}, "line 1 is empty"},
+		"outside":      {[]string{"../a.txt", "b.txt"}, "is outside"},
+		"missing dir":  {[]string{"new/a.txt", "b.txt"}, "directory new does not exist"},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := PlanEdit(dir, original, test.edited, ConflictAbort)
+			if err == nil || !strings.Contains(err.Error(), test.message) {
+				t.Errorf("expected an error containing %q, got %v", test.message, err)
+			}
+		})
+	}
+}
+
+func TestEditKeepsInvalidList(t *testing.T) {
+	db := setupTestDB(t)
+	dir := t.TempDir()
+	createFiles(t, dir, "a.txt", "b.txt")
+
+	err := Edit(db, dir, rewriteList("c.txt"), ConflictAbort, false, "")
+	if err == nil {
+		t.Fatal("expected the edit to be rejected")
+	}
+	_, kept, _ := strings.Cut(err.Error(), "your edits are kept in ")
+	kept = strings.TrimSuffix(kept, ")")
+	if got := readFile(t, kept); !strings.HasPrefix(got, "c.txt") {
+		t.Errorf("expected the edited list to be kept, got %q", got)
+	}
+	os.Remove(kept)
+	assertFiles(t, dir, "a.txt", "b.txt")
+}
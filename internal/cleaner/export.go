@@ -0,0 +1,365 @@
+package cleaner
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"nametidy/internal/utils"
+
+	"gorm.io/gorm"
+)
+
+// HistoryRecord is the portable form of a rename entry used by export and
+// import. Every record carries the metadata of its batch so the file can be
+// read on its own, e.g. in a spreadsheet.
+type HistoryRecord struct {
+	BatchID      string     `json:"batch_id"`
+	Operation    string     `json:"operation"`
+	Status       string     `json:"status,omitempty"`
+	Directory    string     `json:"directory,omitempty"`
+	CommandLine  string     `json:"command_line,omitempty"`
+	User         string     `json:"user,omitempty"`
+	Hostname     string     `json:"hostname,omitempty"`
+	OriginalPath string     `json:"original_path"`
+	NewPath      string     `json:"new_path"`
+	State        string     `json:"state,omitempty"`
+	Size         int64      `json:"size,omitempty"`
+	ModTime      int64      `json:"mod_time,omitempty"`
+	Hash         string     `json:"hash,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UndoneAt     *time.Time `json:"undone_at,omitempty"`
+
+	// Written by older versions instead of Status
+	Reverted   bool       `json:"reverted,omitempty"`
+	Redone     bool       `json:"redone,omitempty"`
+	RevertedAt *time.Time `json:"reverted_at,omitempty"`
+}
+
+var csvHeader = []string{"batch_id", "operation", "original_path", "new_path", "created_at", "status", "directory", "command_line", "user", "hostname", "undone_at", "state", "size", "mod_time", "hash"}
+
+// ParseExportFormat returns "json" or "csv". An empty value is guessed from
+// the file name, falling back to JSON.
+func ParseExportFormat(format, fileName string) (string, error) {
+	if format == "" {
+		format = strings.TrimPrefix(strings.ToLower(filepath.Ext(fileName)), ".")
+		if format != "csv" {
+			format = "json"
+		}
+	}
+	switch f := strings.ToLower(format); f {
+	case "json", "csv":
+		return f, nil
+	}
+	return "", fmt.Errorf("unknown format %q (expected json or csv)", format)
+}
+
+// ExportHistory writes the entries of the batches matching filter to w,
+// oldest first
+func ExportHistory(db *gorm.DB, w io.Writer, format string, filter HistoryFilter) (int, error) {
+	summaries, err := ListBatches(db, filter)
+	if err != nil {
+		return 0, err
+	}
+	ids := make([]string, len(summaries))
+	for i, b := range summaries {
+		ids[i] = b.BatchID
+	}
+
+	var batches []Batch
+	if len(ids) > 0 {
+		err := db.Preload("Entries", func(tx *gorm.DB) *gorm.DB { return tx.Order("id") }).
+			Where("id IN ?", ids).Order("created_at").Find(&batches).Error
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	records := []HistoryRecord{}
+	for _, b := range batches {
+		for _, h := range b.Entries {
+			records = append(records, HistoryRecord{
+				BatchID:      b.ID,
+				Operation:    b.Operation,
+				Status:       b.Status,
+				Directory:    b.Directory,
+				CommandLine:  b.CommandLine,
+				User:         b.User,
+				Hostname:     b.Hostname,
+				OriginalPath: h.OriginalPath,
+				NewPath:      h.NewPath,
+				State:        h.State,
+				Size:         h.Size,
+				ModTime:      h.ModTime,
+				Hash:         h.Hash,
+				CreatedAt:    b.CreatedAt,
+				UndoneAt:     b.UndoneAt,
+			})
+		}
+	}
+
+	if format == "csv" {
+		return len(records), writeCSV(w, records)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return len(records), enc.Encode(records)
+}
+
+func writeCSV(w io.Writer, records []HistoryRecord) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvHeader); err != nil {
+		return err
+	}
+	for _, r := range records {
+		undoneAt := ""
+		if r.UndoneAt != nil {
+			undoneAt = r.UndoneAt.Format(time.RFC3339Nano)
+		}
+		err := cw.Write([]string{
+			r.BatchID, r.Operation, r.OriginalPath, r.NewPath, r.CreatedAt.Format(time.RFC3339Nano),
+			r.Status, r.Directory, r.CommandLine, r.User, r.Hostname, undoneAt, r.State,
+			strconv.FormatInt(r.Size, 10), strconv.FormatInt(r.ModTime, 10), r.Hash,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func readCSV(r io.Reader) ([]HistoryRecord, error) {
+	rows, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+
+	columns := make(map[string]int)
+	for i, name := range rows[0] {
+		columns[strings.TrimSpace(name)] = i
+	}
+	for _, name := range csvHeader[:5] {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("missing column %q", name)
+		}
+	}
+	get := func(row []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(row) {
+			return row[i]
+		}
+		return ""
+	}
+	getTime := func(row []string, name string, line int) (*time.Time, error) {
+		v := get(row, name)
+		if v == "" {
+			return nil, nil
+		}
+		t, err := time.Parse(time.RFC3339Nano, v)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid %s: %v", line, name, err)
+		}
+		return &t, nil
+	}
+
+	var records []HistoryRecord
+	for n, row := range rows[1:] {
+		line := n + 2
+		record := HistoryRecord{
+			BatchID:      get(row, "batch_id"),
+			Operation:    get(row, "operation"),
+			Status:       get(row, "status"),
+			Directory:    get(row, "directory"),
+			CommandLine:  get(row, "command_line"),
+			User:         get(row, "user"),
+			Hostname:     get(row, "hostname"),
+			OriginalPath: get(row, "original_path"),
+			NewPath:      get(row, "new_path"),
+			State:        get(row, "state"),
+			Hash:         get(row, "hash"),
+		}
+		if record.CreatedAt, err = time.Parse(time.RFC3339Nano, get(row, "created_at")); err != nil {
+			return nil, fmt.Errorf("line %d: invalid created_at: %v", line, err)
+		}
+		if record.UndoneAt, err = getTime(row, "undone_at", line); err != nil {
+			return nil, err
+		}
+		if record.RevertedAt, err = getTime(row, "reverted_at", line); err != nil {
+			return nil, err
+		}
+		for name, dst := range map[string]*int64{"size": &record.Size, "mod_time": &record.ModTime} {
+			if v := get(row, name); v != "" {
+				if *dst, err = strconv.ParseInt(v, 10, 64); err != nil {
+					return nil, fmt.Errorf("line %d: invalid %s: %v", line, name, err)
+				}
+			}
+		}
+		for name, dst := range map[string]*bool{"reverted": &record.Reverted, "redone": &record.Redone} {
+			if v := get(row, name); v != "" {
+				if *dst, err = strconv.ParseBool(v); err != nil {
+					return nil, fmt.Errorf("line %d: invalid %s: %v", line, name, err)
+				}
+			}
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// status returns the batch status of a record, deriving it from the flags
+// written by older versions when missing
+func (r *HistoryRecord) status() string {
+	switch {
+	case r.Status != "":
+		return r.Status
+	case r.Reverted:
+		return StatusUndone
+	case r.Redone:
+		return StatusRedone
+	}
+	return StatusApplied
+}
+
+// state returns the entry state of a record, deriving it from the batch
+// status when missing
+func (r *HistoryRecord) state() string {
+	if r.State != "" {
+		return r.State
+	}
+	if r.status() == StatusUndone {
+		return StatusUndone
+	}
+	return StatusApplied
+}
+
+// validateRecords checks every record and that the records of one batch
+// agree with each other
+func validateRecords(records []HistoryRecord) error {
+	batches := make(map[string]HistoryRecord)
+	for i, r := range records {
+		entry := i + 1
+		switch r.status() {
+		case StatusApplied, StatusUndone, StatusRedone, StatusPartial, StatusFailed:
+		default:
+			return fmt.Errorf("entry %d: unknown status %q", entry, r.Status)
+		}
+		if s := r.state(); s != StatusApplied && s != StatusUndone {
+			return fmt.Errorf("entry %d: unknown state %q", entry, r.State)
+		}
+		switch {
+		case r.BatchID == "":
+			return fmt.Errorf("entry %d: missing batch_id", entry)
+		case r.Operation == "":
+			return fmt.Errorf("entry %d: missing operation", entry)
+		case r.OriginalPath == "" || r.NewPath == "":
+			return fmt.Errorf("entry %d: missing original_path or new_path", entry)
+		case r.OriginalPath == r.NewPath:
+			return fmt.Errorf("entry %d: original_path and new_path are the same", entry)
+		case r.CreatedAt.IsZero():
+			return fmt.Errorf("entry %d: missing created_at", entry)
+		case r.Size < 0:
+			return fmt.Errorf("entry %d: negative size", entry)
+		}
+		if first, ok := batches[r.BatchID]; ok {
+			if first.Operation != r.Operation || first.status() != r.status() {
+				return fmt.Errorf("entry %d: batch %s mixes operations or statuses", entry, r.BatchID)
+			}
+			continue
+		}
+		batches[r.BatchID] = r
+	}
+	return nil
+}
+
+// ImportHistory reads exported history from r and adds it to the database,
+// keeping the batch IDs, and returns the number of imported entries. Batches
+// that already exist are skipped. With dryRun the input is only validated.
+func ImportHistory(db *gorm.DB, r io.Reader, format string, dryRun bool) (int, error) {
+	var records []HistoryRecord
+	var err error
+	if format == "csv" {
+		records, err = readCSV(r)
+	} else {
+		err = json.NewDecoder(r).Decode(&records)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse %s: %v", format, err)
+	}
+	if err := validateRecords(records); err != nil {
+		return 0, err
+	}
+
+	var batches []*Batch
+	byID := make(map[string]*Batch)
+	for _, rec := range records {
+		b, ok := byID[rec.BatchID]
+		if !ok {
+			b = &Batch{
+				ID:          rec.BatchID,
+				Operation:   rec.Operation,
+				Status:      rec.status(),
+				Directory:   rec.Directory,
+				CommandLine: rec.CommandLine,
+				User:        rec.User,
+				Hostname:    rec.Hostname,
+				CreatedAt:   rec.CreatedAt,
+				UndoneAt:    rec.UndoneAt,
+			}
+			if b.UndoneAt == nil {
+				b.UndoneAt = rec.RevertedAt
+			}
+			byID[rec.BatchID] = b
+			batches = append(batches, b)
+		}
+		b.Entries = append(b.Entries, RenameHistory{
+			OriginalPath: rec.OriginalPath,
+			NewPath:      rec.NewPath,
+			State:        rec.state(),
+			Fingerprint:  Fingerprint{Size: rec.Size, ModTime: rec.ModTime, Hash: rec.Hash},
+		})
+	}
+
+	var existing []string
+	if len(byID) > 0 {
+		ids := make([]string, 0, len(byID))
+		for id := range byID {
+			ids = append(ids, id)
+		}
+		if err := db.Model(&Batch{}).Where("id IN ?", ids).Pluck("id", &existing).Error; err != nil {
+			return 0, err
+		}
+	}
+	skip := make(map[string]bool)
+	for _, id := range existing {
+		utils.Warn("Skipped batch " + id + " (already in history)")
+		skip[id] = true
+	}
+
+	count := 0
+	var rows []*Batch
+	for _, b := range batches {
+		if skip[b.ID] {
+			continue
+		}
+		if b.Directory == "" {
+			b.Directory = filepath.Dir(b.Entries[0].OriginalPath)
+			for _, h := range b.Entries {
+				b.Directory = commonDir(commonDir(b.Directory, filepath.Dir(h.OriginalPath)), filepath.Dir(h.NewPath))
+			}
+		}
+		rows = append(rows, b)
+		count += len(b.Entries)
+	}
+	if dryRun || len(rows) == 0 {
+		return count, nil
+	}
+	return count, db.Create(&rows).Error
+}
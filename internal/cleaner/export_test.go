@@ -0,0 +1,62 @@
+package cleaner
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestExportImportRoundTrip(t *testing.T) {
+	for _, format := range []string{"json", "csv"} {
+		t.Run(format, func(t *testing.T) {
+			src := setupTestDB(t)
+			dir := t.TempDir()
+			createFiles(t, dir, "a b.txt", "c,d.txt")
+			if err := Clean(src, dir, nil, ConflictSuffix, false, ""); err != nil {
+				t.Fatalf("Clean failed: %v", err)
+			}
+			batchID, _ := GetLastUndoableBatch(src)
+
+			var buf bytes.Buffer
+			count, err := ExportHistory(src, &buf, format, HistoryFilter{})
+			if err != nil || count != 2 {
+				t.Fatalf("expected 2 exported entries, got %d (%v)", count, err)
+			}
+
+			dst := setupTestDB(t)
+			exported := buf.String()
+			count, err = ImportHistory(dst, strings.NewReader(exported), format, false)
+			if err != nil || count != 2 {
+				t.Fatalf("expected 2 imported entries, got %d (%v)", count, err)
+			}
+			histories, _ := GetHistoriesByBatch(dst, batchID)
+			if len(histories) != 2 {
+				t.Fatalf("expected batch %s to keep its ID, got %d entries", batchID, len(histories))
+			}
+
+			// Importing the same file again must not duplicate the batch.
+			count, err = ImportHistory(dst, strings.NewReader(exported), format, false)
+			if err != nil || count != 0 {
+				t.Errorf("expected re-import to skip the batch, got %d (%v)", count, err)
+			}
+		})
+	}
+}
+
+func TestImportHistoryValidation(t *testing.T) {
+	db := setupTestDB(t)
+	tests := map[string]string{
+		"missing batch": `[{"operation":"clean","original_path":"/a","new_path":"/b","created_at":"2025-01-01T00:00:00Z"}]`,
+		"same paths":    `[{"batch_id":"x","operation":"clean","original_path":"/a","new_path":"/a","created_at":"2025-01-01T00:00:00Z"}]`,
+		"no time":       `[{"batch_id":"x","operation":"clean","original_path":"/a","new_path":"/b"}]`,
+		"mixed batch": `[{"batch_id":"x","operation":"clean","original_path":"/a","new_path":"/b","created_at":"2025-01-01T00:00:00Z"},
+			{"batch_id":"x","operation":"number","original_path":"/c","new_path":"/d","created_at":"2025-01-01T00:00:00Z"}]`,
+	}
+	for name, input := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := ImportHistory(db, strings.NewReader(input), "json", false); err == nil {
+				t.Error("expected a validation error")
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package cleaner
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// hashSample is how much of the start and the end of a file goes into the
+// fast hash
+const hashSample = 64 * 1024
+
+// hashContents enables the content hash in new fingerprints
+var hashContents = false
+
+// SetContentHashing turns the content hash of new fingerprints on or off.
+// Size and modification time are always recorded.
+func SetContentHashing(enabled bool) {
+	hashContents = enabled
+}
+
+// Fingerprint identifies the content of a renamed file so undo and redo can
+// tell whether the file at a recorded path is still the one nametidy moved.
+// Zero values mean "not recorded" (history written by older versions).
+type Fingerprint struct {
+	Size    int64  `gorm:"not null;default:0" json:"size"`
+	ModTime int64  `gorm:"not null;default:0" json:"mod_time"` // UnixNano
+	Hash    string `gorm:"not null;default:''" json:"hash,omitempty"`
+}
+
+// TakeFingerprint reads the fingerprint of the file at path, hashing its
+// content when enabled with SetContentHashing
+func TakeFingerprint(path string) (Fingerprint, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return Fingerprint{}, err
+	}
+	fp := Fingerprint{Size: info.Size(), ModTime: info.ModTime().UnixNano()}
+	if hashContents && info.Mode().IsRegular() {
+		if fp.Hash, err = fastHash(path, info.Size()); err != nil {
+			return Fingerprint{}, err
+		}
+	}
+	return fp, nil
+}
+
+// Recorded reports whether the fingerprint holds any information
+func (f Fingerprint) Recorded() bool {
+	return f.Size != 0 || f.ModTime != 0 || f.Hash != ""
+}
+
+// Verify compares the file at path with the fingerprint and describes the
+// first difference, or returns an empty string when it matches. Fields that
+// were not recorded are not checked.
+func (f Fingerprint) Verify(path string) (string, error) {
+	if !f.Recorded() {
+		return "", nil
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	if info.Size() != f.Size {
+		return fmt.Sprintf("size changed from %d to %d bytes", f.Size, info.Size()), nil
+	}
+	if f.ModTime != 0 && info.ModTime().UnixNano() != f.ModTime {
+		return fmt.Sprintf("modified at %s", info.ModTime().Format(time.RFC3339)), nil
+	}
+	if f.Hash != "" {
+		hash, err := fastHash(path, info.Size())
+		if err != nil {
+			return "", err
+		}
+		if hash != f.Hash {
+			return "content hash changed", nil
+		}
+	}
+	return "", nil
+}
+
+// fastHash returns a SHA-256 over the size and the first and last hashSample
+// bytes of the file. It does not read large files completely, which is enough
+// to notice a file that was replaced rather than renamed.
+func fastHash(path string, size int64) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	fmt.Fprintf(h, "%d:", size)
+	if size <= 2*hashSample {
+		if _, err := io.Copy(h, f); err != nil {
+			return "", err
+		}
+	} else {
+		if _, err := io.CopyN(h, f, hashSample); err != nil {
+			return "", err
+		}
+		if _, err := f.Seek(-hashSample, io.SeekEnd); err != nil {
+			return "", err
+		}
+		if _, err := io.Copy(h, f); err != nil {
+			return "", err
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16], nil
+}
@@ -0,0 +1,81 @@
+package cleaner
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFingerprintVerify(t *testing.T) {
+	SetContentHashing(true)
+	defer SetContentHashing(false)
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "a.txt")
+	createFiles(t, dir, "a.txt")
+	fp, err := TakeFingerprint(path)
+	if err != nil {
+		t.Fatalf("TakeFingerprint failed: %v", err)
+	}
+	if fp.Size != int64(len("a.txt")) || fp.Hash == "" {
+		t.Fatalf("unexpected fingerprint: %+v", fp)
+	}
+	if mismatch, err := fp.Verify(path); err != nil || mismatch != "" {
+		t.Errorf("expected an unchanged file to match, got %q (%v)", mismatch, err)
+	}
+
+	// Same size and time, different content: only the hash notices.
+	mtime := time.Unix(0, fp.ModTime)
+	if err := os.WriteFile(path, []byte("b.txt"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+	if mismatch, _ := fp.Verify(path); mismatch != "content hash changed" {
+		t.Errorf("expected a hash mismatch, got %q", mismatch)
+	}
+
+	if err := os.WriteFile(path, []byte("longer content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if mismatch, _ := fp.Verify(path); !strings.HasPrefix(mismatch, "size changed") {
+		t.Errorf("expected a size mismatch, got %q", mismatch)
+	}
+
+	// History written before fingerprints existed is never a mismatch.
+	if mismatch, err := (Fingerprint{}).Verify(path); err != nil || mismatch != "" {
+		t.Errorf("expected an empty fingerprint to match, got %q (%v)", mismatch, err)
+	}
+}
+
+func TestUndoSkipsReplacedFiles(t *testing.T) {
+	db := setupTestDB(t)
+	dir := t.TempDir()
+	createFiles(t, dir, "a b.txt", "c d.txt")
+	if err := Clean(db, dir, nil, ConflictSuffix, false, ""); err != nil {
+		t.Fatalf("Clean failed: %v", err)
+	}
+	batchID, _ := GetLastUndoableBatch(db)
+
+	// Someone replaced a_b.txt with a different file of the same name.
+	if err := os.WriteFile(filepath.Join(dir, "a_b.txt"), []byte("something else"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := UndoBatch(db, dir, batchID, false, false); err == nil {
+		t.Error("expected UndoBatch to refuse a replaced file")
+	}
+
+	var incomplete *IncompleteError
+	if err := Undo(db, dir, 1, false); !errors.As(err, &incomplete) || incomplete.Report.Count(ResultConflicted) != 1 {
+		t.Fatalf("expected one conflicted entry, got %v", err)
+	}
+	assertFiles(t, dir, "a_b.txt", "c d.txt")
+	if batch, _ := GetBatch(db, batchID); batch.Status != StatusPartial {
+		t.Errorf("expected the batch to be partially undone, got %s", batch.Status)
+	}
+}
@@ -2,17 +2,209 @@ package cleaner
 
 import (
 	"fmt"
+	"path/filepath"
+	"time"
+
+	"nametidy/internal/utils"
 
 	"gorm.io/gorm"
 )
 
+// BatchSummary describes one recorded batch for `history list`
+type BatchSummary struct {
+	BatchID   string
+	Operation string
+	Status    string
+	Directory string
+	User      string
+	Hostname  string
+	CreatedAt time.Time
+	Files     int
+}
+
+// HistoryFilter narrows down the batches returned by ListBatches. Zero values
+// match everything.
+type HistoryFilter struct {
+	Since     time.Time
+	Until     time.Time
+	Operation string
+	Path      string // only batches that touched files under this directory
+}
+
+// ListBatches returns the recorded batches matching filter, newest first
+func ListBatches(db *gorm.DB, filter HistoryFilter) ([]BatchSummary, error) {
+	query := db.Order("created_at desc")
+	if !filter.Since.IsZero() {
+		query = query.Where("created_at >= ?", filter.Since)
+	}
+	if !filter.Until.IsZero() {
+		query = query.Where("created_at < ?", filter.Until)
+	}
+	if filter.Operation != "" {
+		query = query.Where("operation = ?", filter.Operation)
+	}
+	var batches []Batch
+	if err := query.Find(&batches).Error; err != nil {
+		return nil, err
+	}
+
+	var counts []struct {
+		BatchID string
+		Files   int
+	}
+	if err := db.Model(&RenameHistory{}).Select("batch_id, COUNT(*) AS files").Group("batch_id").Scan(&counts).Error; err != nil {
+		return nil, err
+	}
+	files := make(map[string]int)
+	for _, c := range counts {
+		files[c.BatchID] = c.Files
+	}
+
+	var touching map[string]bool
+	if filter.Path != "" {
+		root, err := absPath(filter.Path)
+		if err != nil {
+			return nil, err
+		}
+		if touching, err = batchesTouching(db, root); err != nil {
+			return nil, err
+		}
+	}
+
+	summaries := []BatchSummary{}
+	for _, b := range batches {
+		if touching != nil && !touching[b.ID] {
+			continue
+		}
+		summaries = append(summaries, BatchSummary{
+			BatchID:   b.ID,
+			Operation: b.Operation,
+			Status:    b.Status,
+			Directory: b.Directory,
+			User:      b.User,
+			Hostname:  b.Hostname,
+			CreatedAt: b.CreatedAt,
+			Files:     files[b.ID],
+		})
+	}
+	return summaries, nil
+}
+
+// batchesTouching returns the IDs of batches with an entry under root. Failed
+// batches have no entries and are matched by their directory instead.
+func batchesTouching(db *gorm.DB, root string) (map[string]bool, error) {
+	touching := make(map[string]bool)
+
+	var entries []RenameHistory
+	if err := db.Select("batch_id, original_path, new_path").Find(&entries).Error; err != nil {
+		return nil, err
+	}
+	for _, h := range entries {
+		if storedWithin(root, h.OriginalPath) || storedWithin(root, h.NewPath) {
+			touching[h.BatchID] = true
+		}
+	}
+
+	var failed []Batch
+	if err := db.Where("status = ?", StatusFailed).Find(&failed).Error; err != nil {
+		return nil, err
+	}
+	for _, b := range failed {
+		if storedWithin(root, b.Directory) {
+			touching[b.ID] = true
+		}
+	}
+	return touching, nil
+}
+
+// commonDir returns the deepest directory containing both a and b
+func commonDir(a, b string) string {
+	for !utils.IsWithin(a, b) {
+		parent := filepath.Dir(a)
+		if parent == a {
+			return a
+		}
+		a = parent
+	}
+	return a
+}
+
+// deleteBatches removes the given batches and their entries and returns the
+// number of entries deleted
+func deleteBatches(tx *gorm.DB, batchIDs []string) (int64, error) {
+	result := tx.Where("batch_id IN ?", batchIDs).Delete(&RenameHistory{})
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	if err := tx.Where("id IN ?", batchIDs).Delete(&Batch{}).Error; err != nil {
+		return 0, err
+	}
+	return result.RowsAffected, nil
+}
+
 // ClearHistory deletes all rename history records in the database
 func ClearHistory(db *gorm.DB) error {
-	result := db.Session(&gorm.Session{AllowGlobalUpdate: true}).Delete(&RenameHistory{})
-	if result.Error != nil {
-		return result.Error
+	var deleted int64
+	err := db.Transaction(func(tx *gorm.DB) error {
+		global := tx.Session(&gorm.Session{AllowGlobalUpdate: true})
+		result := global.Delete(&RenameHistory{})
+		if result.Error != nil {
+			return result.Error
+		}
+		deleted = result.RowsAffected
+		return global.Delete(&Batch{}).Error
+	})
+	if err != nil {
+		return err
 	}
 
-	fmt.Printf("Deleted %d total history entries.\n", result.RowsAffected)
+	fmt.Printf("Deleted %d total history entries.\n", deleted)
 	return nil
+}
+
+// PruneOptions selects the batches removed by PruneHistory. Batches must match
+// BatchID and Path when set; OlderThan and KeepLast then decide which of them
+// go.
+type PruneOptions struct {
+	OlderThan time.Duration // 0: any age
+	KeepLast  int           // always keep this many of the newest batches; < 0: no limit
+	BatchID   string
+	Path      string
+}
+
+// PruneHistory deletes the batches selected by opts and returns how many
+// batches and entries were (or, with dryRun, would be) removed.
+func PruneHistory(db *gorm.DB, opts PruneOptions, dryRun bool) (int, int64, error) {
+	batches, err := ListBatches(db, HistoryFilter{Path: opts.Path})
+	if err != nil {
+		return 0, 0, err
+	}
+
+	cutoff := time.Now().Add(-opts.OlderThan)
+	var ids []string
+	var entries int64
+	kept := 0
+	for _, b := range batches {
+		if opts.BatchID != "" && b.BatchID != opts.BatchID {
+			continue
+		}
+		if opts.KeepLast >= 0 && kept < opts.KeepLast {
+			kept++
+			continue
+		}
+		if opts.OlderThan > 0 && !b.CreatedAt.Before(cutoff) {
+			continue
+		}
+		ids = append(ids, b.BatchID)
+		entries += int64(b.Files)
+	}
+
+	if dryRun || len(ids) == 0 {
+		return len(ids), entries, nil
+	}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		entries, err = deleteBatches(tx, ids)
+		return err
+	})
+	return len(ids), entries, err
 }
\ No newline at end of file
@@ -1,6 +1,9 @@
 package cleaner
 
 import (
+	"fmt"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -14,7 +17,7 @@ func setupTestDB(t *testing.T) *gorm.DB {
 		t.Fatalf("failed to open test DB: %v", err)
 	}
 
-	if err := db.AutoMigrate(&RenameHistory{}); err != nil {
+	if _, err := Migrate(db, false); err != nil {
 		t.Fatalf("failed to migrate schema: %v", err)
 	}
 
@@ -22,21 +25,14 @@ func setupTestDB(t *testing.T) *gorm.DB {
 }
 
 func insertDummyHistories(db *gorm.DB, count int) error {
+	batch := Batch{ID: "test-batch", Operation: "clean", Status: StatusApplied}
 	for i := 0; i < count; i++ {
-		record := RenameHistory{
+		batch.Entries = append(batch.Entries, RenameHistory{
 			OriginalPath: "dummy/original.txt",
 			NewPath:      "dummy/renamed.txt",
-			Operation:    "clean",
-			BatchID:      "test-batch",
-			CreatedAt:    time.Now(),
-			Reverted:     false,
-			Redone:       false,
-		}
-		if err := db.Create(&record).Error; err != nil {
-			return err
-		}
+		})
 	}
-	return nil
+	return db.Create(&batch).Error
 }
 
 func TestClearHistory(t *testing.T) {
@@ -62,4 +58,134 @@ func TestClearHistory(t *testing.T) {
 	if count != 0 {
 		t.Fatalf("expected 0 history records after clear, got %d", count)
 	}
+	db.Model(&Batch{}).Count(&count)
+	if count != 0 {
+		t.Fatalf("expected 0 batches after clear, got %d", count)
+	}
+}
+
+func TestListBatches(t *testing.T) {
+	db := setupTestDB(t)
+	root := t.TempDir()
+	photos, docs := filepath.Join(root, "photos"), filepath.Join(root, "docs")
+	for _, dir := range []string{photos, docs} {
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatalf("failed to create %s: %v", dir, err)
+		}
+		createFiles(t, dir, "a b.txt", "c d.txt")
+	}
+	if err := Clean(db, photos, nil, ConflictSuffix, false, ""); err != nil {
+		t.Fatalf("Clean failed: %v", err)
+	}
+	if err := NumberFiles(db, docs, 2, false, ConflictSuffix, false, ""); err != nil {
+		t.Fatalf("NumberFiles failed: %v", err)
+	}
+
+	batches, err := ListBatches(db, HistoryFilter{})
+	if err != nil {
+		t.Fatalf("ListBatches failed: %v", err)
+	}
+	if len(batches) != 2 || batches[0].Operation != "number" || batches[1].Operation != "clean" {
+		t.Fatalf("expected number and clean batches, newest first, got %+v", batches)
+	}
+	if batches[1].Directory != photos || batches[1].Files != 2 || batches[1].Status != StatusApplied {
+		t.Errorf("unexpected summary for clean batch: %+v", batches[1])
+	}
+
+	batches, _ = ListBatches(db, HistoryFilter{Path: docs})
+	if len(batches) != 1 || batches[0].Operation != "number" {
+		t.Errorf("expected only the docs batch, got %+v", batches)
+	}
+
+	batches, _ = ListBatches(db, HistoryFilter{Operation: "clean"})
+	if len(batches) != 1 || batches[0].Operation != "clean" {
+		t.Errorf("expected only the clean batch, got %+v", batches)
+	}
+
+	batches, _ = ListBatches(db, HistoryFilter{Since: time.Now().Add(time.Hour)})
+	if len(batches) != 0 {
+		t.Errorf("expected no batches in the future, got %+v", batches)
+	}
+}
+
+func TestListBatchesWithRelativePaths(t *testing.T) {
+	db := setupTestDB(t)
+	// Older versions stored paths relative to the working directory
+	if err := insertDummyHistories(db, 1); err != nil {
+		t.Fatalf("failed to insert dummy histories: %v", err)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{".", wd, filepath.Join(wd, "dummy")} {
+		batches, err := ListBatches(db, HistoryFilter{Path: path})
+		if err != nil {
+			t.Fatalf("ListBatches failed: %v", err)
+		}
+		if len(batches) != 1 || batches[0].BatchID != "test-batch" {
+			t.Errorf("expected the relative batch under %s, got %+v", path, batches)
+		}
+	}
+}
+
+func TestPruneHistory(t *testing.T) {
+	db := setupTestDB(t)
+	now := time.Now()
+	for i, age := range []time.Duration{0, 10 * 24 * time.Hour, 40 * 24 * time.Hour, 50 * 24 * time.Hour} {
+		batch := Batch{
+			ID:        fmt.Sprintf("clean-%d", i),
+			Operation: "clean",
+			Status:    StatusApplied,
+			Directory: fmt.Sprintf("/data/%d", i),
+			CreatedAt: now.Add(-age),
+		}
+		for j := 0; j < 2; j++ {
+			batch.Entries = append(batch.Entries, RenameHistory{
+				OriginalPath: fmt.Sprintf("/data/%d/original%d.txt", i, j),
+				NewPath:      fmt.Sprintf("/data/%d/renamed%d.txt", i, j),
+			})
+		}
+		if err := db.Create(&batch).Error; err != nil {
+			t.Fatalf("failed to insert history: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		opts    PruneOptions
+		batches int
+	}{
+		{"older than 30 days", PruneOptions{OlderThan: 30 * 24 * time.Hour, KeepLast: -1}, 2},
+		{"keep last 3", PruneOptions{KeepLast: 3}, 1},
+		{"older than 30 days but keep last 3", PruneOptions{OlderThan: 30 * 24 * time.Hour, KeepLast: 3}, 1},
+		{"single batch", PruneOptions{BatchID: "clean-1", KeepLast: -1}, 1},
+		{"path", PruneOptions{Path: "/data/2", KeepLast: -1}, 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			batches, entries, err := PruneHistory(db, test.opts, true)
+			if err != nil {
+				t.Fatalf("PruneHistory failed: %v", err)
+			}
+			if batches != test.batches || entries != int64(2*test.batches) {
+				t.Errorf("expected %d batches, got %d batches / %d entries", test.batches, batches, entries)
+			}
+		})
+	}
+
+	batches, entries, err := PruneHistory(db, PruneOptions{OlderThan: 30 * 24 * time.Hour, KeepLast: -1}, false)
+	if err != nil || batches != 2 || entries != 4 {
+		t.Fatalf("expected 2 batches / 4 entries deleted, got %d / %d (%v)", batches, entries, err)
+	}
+	var count int64
+	db.Model(&RenameHistory{}).Count(&count)
+	if count != 4 {
+		t.Errorf("expected 4 history records left, got %d", count)
+	}
+	db.Model(&Batch{}).Count(&count)
+	if count != 2 {
+		t.Errorf("expected 2 batches left, got %d", count)
+	}
 }
\ No newline at end of file
@@ -0,0 +1,238 @@
+package cleaner
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"nametidy/internal/utils"
+
+	"gorm.io/gorm"
+)
+
+// JournalEntry is one step of a batch, written before the rename happens and
+// marked done right after it. Entries are removed once the batch has been
+// recorded in the history, so anything left over belongs to an interrupted run.
+type JournalEntry struct {
+	ID        uint   `gorm:"primaryKey"`
+	BatchID   string `gorm:"index"`
+	Operation string
+	Reverts   string
+	Root      string
+	Seq       int
+	FromPath  string
+	ToPath    string
+	Source    string
+	Target    string
+	Final     bool
+	Done      bool
+	CreatedAt time.Time
+}
+
+// IncompleteBatch summarizes a batch left behind in the journal
+type IncompleteBatch struct {
+	BatchID   string
+	Operation string
+	Done      int
+	Total     int
+	CreatedAt time.Time
+}
+
+type journal struct {
+	db      *gorm.DB
+	batchID string
+	rows    []JournalEntry
+}
+
+// openJournal writes every step of the plan to the journal as not done
+func openJournal(db *gorm.DB, p *Plan, steps []step) (*journal, error) {
+	now := time.Now()
+	rows := make([]JournalEntry, len(steps))
+	for i, s := range steps {
+		rows[i] = JournalEntry{
+			BatchID:   p.BatchID,
+			Operation: p.Operation,
+			Reverts:   p.Reverts,
+			Root:      p.Root,
+			Seq:       i,
+			FromPath:  s.From,
+			ToPath:    s.To,
+			Source:    s.Source,
+			Target:    s.Target,
+			Final:     s.Final,
+			CreatedAt: now,
+		}
+	}
+	if err := db.Create(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to write journal: %v", err)
+	}
+	return &journal{db: db, batchID: p.BatchID, rows: rows}, nil
+}
+
+// loadJournal reads the steps of an interrupted batch
+func loadJournal(db *gorm.DB, batchID string) (*journal, error) {
+	var rows []JournalEntry
+	if err := db.Where("batch_id = ?", batchID).Order("seq").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("no interrupted batch %s", batchID)
+	}
+	return &journal{db: db, batchID: batchID, rows: rows}, nil
+}
+
+// mark records that step i has been applied or reverted
+func (j *journal) mark(i int, done bool) error {
+	j.rows[i].Done = done
+	return j.db.Model(&j.rows[i]).Update("done", done).Error
+}
+
+// clear removes the journal of the batch
+func (j *journal) clear(tx *gorm.DB) error {
+	return tx.Where("batch_id = ?", j.batchID).Delete(&JournalEntry{}).Error
+}
+
+// close is called after a failed batch has been rolled back. The journal is
+// only kept when some files could not be moved back.
+func (j *journal) close(err error) error {
+	var applyErr *ApplyError
+	if errors.As(err, &applyErr) && len(applyErr.Stuck) > 0 {
+		return fmt.Errorf("%v (run `nametidy recover` to retry)", err)
+	}
+	if clearErr := j.clear(j.db); clearErr != nil {
+		utils.Warn(fmt.Sprintf("Failed to clear journal of %s: %v", j.batchID, clearErr))
+	}
+	return err
+}
+
+func (j *journal) steps() []step {
+	steps := make([]step, len(j.rows))
+	for i, r := range j.rows {
+		steps[i] = step{From: r.FromPath, To: r.ToPath, Source: r.Source, Target: r.Target, Final: r.Final}
+	}
+	return steps
+}
+
+// plan rebuilds the plan the journal was written for
+func (j *journal) plan() *Plan {
+	first := j.rows[0]
+	p := &Plan{Operation: first.Operation, BatchID: j.batchID, Reverts: first.Reverts, Root: first.Root}
+	for _, r := range j.rows {
+		if r.Final {
+			p.Entries = append(p.Entries, PlanEntry{Source: r.Source, Target: r.Target})
+		}
+	}
+	return p
+}
+
+// reconcile fixes the done flag around the point where the run stopped. Steps
+// are marked in order, so only the first pending step (renamed but not yet
+// marked) or the last done step (reverted but not yet marked) can be off.
+func (j *journal) reconcile() (int, error) {
+	done := 0
+	for done < len(j.rows) && j.rows[done].Done {
+		done++
+	}
+	if done < len(j.rows) {
+		r := j.rows[done]
+		if !utils.FileExists(r.FromPath) && utils.FileExists(r.ToPath) {
+			if err := j.mark(done, true); err != nil {
+				return 0, err
+			}
+			done++
+		}
+	} else if done > 0 {
+		r := j.rows[done-1]
+		if utils.FileExists(r.FromPath) && !utils.FileExists(r.ToPath) {
+			if err := j.mark(done-1, false); err != nil {
+				return 0, err
+			}
+			done--
+		}
+	}
+	return done, nil
+}
+
+// FindIncompleteBatches lists the batches whose journal was never cleared
+func FindIncompleteBatches(db *gorm.DB) ([]IncompleteBatch, error) {
+	var rows []JournalEntry
+	if err := db.Order("created_at, seq").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	var batches []IncompleteBatch
+	index := make(map[string]int)
+	for _, r := range rows {
+		i, ok := index[r.BatchID]
+		if !ok {
+			i = len(batches)
+			index[r.BatchID] = i
+			batches = append(batches, IncompleteBatch{BatchID: r.BatchID, Operation: r.Operation, CreatedAt: r.CreatedAt})
+		}
+		batches[i].Total++
+		if r.Done {
+			batches[i].Done++
+		}
+	}
+	return batches, nil
+}
+
+// Recover finishes (finish == true) or rolls back an interrupted batch. A
+// finished batch is recorded in the history as if it had never stopped.
+func Recover(db *gorm.DB, batchID string, finish bool, dryRun bool) error {
+	j, err := loadJournal(db, batchID)
+	if err != nil {
+		return err
+	}
+	done, err := j.reconcile()
+	if err != nil {
+		return err
+	}
+	steps := j.steps()
+
+	if finish {
+		if dryRun {
+			for _, s := range steps[done:] {
+				fmt.Printf("[DRY-RUN] %s → %s\n", displayPath(s.From), displayPath(s.To))
+			}
+			return nil
+		}
+		_, err := runSteps(steps[done:], func(i int, ok bool) error {
+			return j.mark(done+i, ok)
+		})
+		if err != nil {
+			return err
+		}
+		return db.Transaction(func(tx *gorm.DB) error {
+			if err := j.plan().record(tx); err != nil {
+				return err
+			}
+			return j.clear(tx)
+		})
+	}
+
+	var failed []string
+	for i := done - 1; i >= 0; i-- {
+		s := steps[i]
+		if dryRun {
+			fmt.Printf("[DRY-RUN] %s → %s\n", displayPath(s.To), displayPath(s.From))
+			continue
+		}
+		if err := os.Rename(s.To, s.From); err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", s.To, err))
+			continue
+		}
+		fmt.Printf("Rolled back: %s → %s\n", displayPath(s.To), displayPath(s.From))
+		if err := j.mark(i, false); err != nil {
+			return err
+		}
+	}
+	if dryRun {
+		return nil
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("could not roll back %d file(s): %v", len(failed), failed)
+	}
+	return j.clear(db)
+}
@@ -0,0 +1,105 @@
+package cleaner
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+// interruptBatch journals a clean plan for dir and applies only its first
+// step, as if the process had been killed before marking it done.
+func interruptBatch(t *testing.T, db *gorm.DB, dir string) *Plan {
+	t.Helper()
+	createFiles(t, dir, "a b.txt", "c d.txt")
+
+	plan, err := PlanClean(dir, nil, ConflictSuffix)
+	if err != nil {
+		t.Fatalf("PlanClean failed: %v", err)
+	}
+	steps := plan.steps()
+	if _, err := openJournal(db, plan, steps); err != nil {
+		t.Fatalf("openJournal failed: %v", err)
+	}
+	if err := os.Rename(steps[0].From, steps[0].To); err != nil {
+		t.Fatalf("rename failed: %v", err)
+	}
+	return plan
+}
+
+func TestRecoverFinish(t *testing.T) {
+	db := setupTestDB(t)
+	dir := t.TempDir()
+	plan := interruptBatch(t, db, dir)
+
+	batches, err := FindIncompleteBatches(db)
+	if err != nil || len(batches) != 1 || batches[0].BatchID != plan.BatchID {
+		t.Fatalf("expected one incomplete batch, got %+v (%v)", batches, err)
+	}
+
+	if err := Recover(db, plan.BatchID, true, false); err != nil {
+		t.Fatalf("Recover failed: %v", err)
+	}
+	for _, name := range []string{"a_b.txt", "c_d.txt"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("%s should exist after finishing: %v", name, err)
+		}
+	}
+
+	histories, _ := GetHistoriesByBatch(db, plan.BatchID)
+	if len(histories) != 2 {
+		t.Errorf("expected 2 history records, got %d", len(histories))
+	}
+	if batches, _ := FindIncompleteBatches(db); len(batches) != 0 {
+		t.Errorf("journal should be cleared, got %+v", batches)
+	}
+}
+
+func TestRecoverRollback(t *testing.T) {
+	db := setupTestDB(t)
+	dir := t.TempDir()
+	plan := interruptBatch(t, db, dir)
+
+	if err := Recover(db, plan.BatchID, false, false); err != nil {
+		t.Fatalf("Recover failed: %v", err)
+	}
+	for _, name := range []string{"a b.txt", "c d.txt"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("%s should be restored: %v", name, err)
+		}
+	}
+
+	histories, _ := GetHistoriesByBatch(db, plan.BatchID)
+	if len(histories) != 0 {
+		t.Errorf("rolled back batch should not be recorded, got %d records", len(histories))
+	}
+	if batches, _ := FindIncompleteBatches(db); len(batches) != 0 {
+		t.Errorf("journal should be cleared, got %+v", batches)
+	}
+}
+
+func TestRecoverFinishAfterStuckRollback(t *testing.T) {
+	db := setupTestDB(t)
+	dir := t.TempDir()
+	plan := interruptBatch(t, db, dir)
+	// Commit records the batch as failed when its rollback gets stuck and
+	// keeps the journal under the same ID.
+	plan.recordFailure(db)
+
+	if err := Recover(db, plan.BatchID, true, false); err != nil {
+		t.Fatalf("Recover failed: %v", err)
+	}
+	batch, err := GetBatch(db, plan.BatchID)
+	if err != nil {
+		t.Fatalf("GetBatch failed: %v", err)
+	}
+	if batch.Status != StatusApplied || len(batch.Entries) != 2 {
+		t.Errorf("expected an applied batch with 2 renames, got %s with %d", batch.Status, len(batch.Entries))
+	}
+	var count int64
+	db.Model(&Batch{}).Where("id = ?", plan.BatchID).Count(&count)
+	if count != 1 {
+		t.Errorf("expected the failed record to be replaced, got %d batches", count)
+	}
+}
@@ -0,0 +1,190 @@
+package cleaner
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"nametidy/internal/utils"
+
+	"gorm.io/gorm"
+)
+
+// Mapping is one old → new pair of a mapping file. Line is where it was read
+// (the entry number for JSON) and is used in error messages.
+type Mapping struct {
+	Old  string `json:"old"`
+	New  string `json:"new"`
+	Line int    `json:"-"`
+}
+
+func ApplyMapping(db *gorm.DB, dirPath, mapPath string, policy ConflictPolicy, dryRun bool, planOut string) error {
+	mappings, err := ReadMapping(mapPath)
+	if err != nil {
+		return err
+	}
+	plan, err := PlanMapping(dirPath, mappings, policy)
+	if err != nil {
+		return err
+	}
+	plan.Options["map"] = mapPath
+	return execute(db, plan, dryRun, planOut)
+}
+
+// ReadMapping reads a mapping file. The format follows the extension: .json
+// holds a list of {"old": ..., "new": ...} objects or a single {"old": "new"}
+// object, .tsv and .tab are tab separated, anything else is CSV. A first row
+// of old,new is taken as a header.
+func ReadMapping(path string) ([]Mapping, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return readJSONMapping(f)
+	case ".tsv", ".tab":
+		return readDelimitedMapping(f, '\t')
+	}
+	return readDelimitedMapping(f, ',')
+}
+
+func readJSONMapping(r io.Reader) ([]Mapping, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var list []Mapping
+	if err := json.Unmarshal(data, &list); err == nil {
+		for i := range list {
+			list[i].Line = i + 1
+		}
+		return list, nil
+	}
+	var pairs map[string]string
+	if err := json.Unmarshal(data, &pairs); err != nil {
+		return nil, fmt.Errorf("expected a list of {\"old\": ..., \"new\": ...} objects or an {\"old\": \"new\"} object: %w", err)
+	}
+	for oldName, newName := range pairs {
+		list = append(list, Mapping{Old: oldName, New: newName})
+	}
+	// Map order is random; sort so plans and errors are reproducible.
+	sort.Slice(list, func(i, j int) bool { return list[i].Old < list[j].Old })
+	for i := range list {
+		list[i].Line = i + 1
+	}
+	return list, nil
+}
+
+func readDelimitedMapping(r io.Reader, sep rune) ([]Mapping, error) {
+	reader := csv.NewReader(r)
+	reader.Comma = sep
+	reader.FieldsPerRecord = 2
+	reader.Comment = '#'
+	if sep == '\t' {
+		reader.LazyQuotes = true
+	}
+
+	var list []Mapping
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := reader.FieldPos(0)
+		if line == 1 {
+			// Spreadsheets often start the file with a byte order mark
+			row[0] = strings.TrimPrefix(row[0], "\ufeff")
+			if strings.EqualFold(row[0], "old") && strings.EqualFold(row[1], "new") {
+				continue
+			}
+		}
+		list = append(list, Mapping{Old: row[0], New: row[1], Line: line})
+	}
+	return list, nil
+}
+
+// PlanMapping builds the rename plan for the given pairs. Relative paths are
+// taken relative to dirPath and every path must lie below it. All problems
+// are reported together: missing or repeated sources, two sources renamed to
+// the same name, and new names in directories that do not exist. Chains and
+// cycles (a → b, b → a) are fine.
+func PlanMapping(dirPath string, mappings []Mapping, policy ConflictPolicy) (*Plan, error) {
+	root, err := absPath(dirPath)
+	if err != nil {
+		return nil, err
+	}
+	plan := NewPlan("apply", root)
+	plan.Options = map[string]string{"on_conflict": string(policy)}
+
+	var problems []error
+	problem := func(m Mapping, format string, args ...interface{}) {
+		problems = append(problems, fmt.Errorf("line %d: %s", m.Line, fmt.Sprintf(format, args...)))
+	}
+	sources := make(map[string]int)
+	targets := make(map[string]int)
+	for _, m := range mappings {
+		if m.Old == "" || m.New == "" {
+			problem(m, "both the old and the new name are required")
+			continue
+		}
+		source, target := resolveIn(root, m.Old), resolveIn(root, m.New)
+		switch {
+		case !withinRoot(root, source):
+			problem(m, "%s is outside %s", m.Old, root)
+		case !withinRoot(root, target):
+			problem(m, "%s is outside %s", m.New, root)
+		default:
+			if info, err := os.Lstat(source); err != nil {
+				problem(m, "%s does not exist", m.Old)
+			} else if info.IsDir() {
+				problem(m, "%s is a directory", m.Old)
+			}
+			if prev, ok := sources[source]; ok {
+				problem(m, "%s is already renamed on line %d", m.Old, prev)
+			}
+			if prev, ok := targets[target]; ok && source != target {
+				problem(m, "%s is already the new name on line %d", m.New, prev)
+			}
+			if !utils.IsDirectory(filepath.Dir(target)) {
+				problem(m, "directory %s does not exist", filepath.Dir(m.New))
+			}
+		}
+		sources[source] = m.Line
+		targets[target] = m.Line
+		plan.Add(source, target, fmt.Sprintf("mapping line %d", m.Line))
+	}
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("invalid mapping:\n%w", errors.Join(problems...))
+	}
+
+	if err := plan.Resolve(policy); err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+// resolveIn returns path as an absolute path, taking relative paths relative
+// to root
+func resolveIn(root, path string) string {
+	if filepath.IsAbs(path) {
+		return filepath.Clean(path)
+	}
+	return filepath.Join(root, path)
+}
+
+// withinRoot reports whether path lies below root, without being root itself
+func withinRoot(root, path string) bool {
+	return utils.IsWithin(root, path) && path != root
+}
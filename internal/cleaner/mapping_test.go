@@ -0,0 +1,111 @@
+package cleaner
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeMapping(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestReadMappingFormats(t *testing.T) {
+	tests := map[string]string{
+		"renames.csv":  "\ufeffold,new\na.txt,b.txt\n\"c, d.txt\",e.txt\n",
+		"renames.tsv":  "a.txt\tb.txt\nc, d.txt\te.txt\n",
+		"renames.json": `[{"old": "a.txt", "new": "b.txt"}, {"old": "c, d.txt", "new": "e.txt"}]`,
+		"object.json":  `{"c, d.txt": "e.txt", "a.txt": "b.txt"}`,
+	}
+	for name, content := range tests {
+		mappings, err := ReadMapping(writeMapping(t, name, content))
+		if err != nil {
+			t.Errorf("%s: ReadMapping failed: %v", name, err)
+			continue
+		}
+		if len(mappings) != 2 || mappings[0].Old != "a.txt" || mappings[0].New != "b.txt" || mappings[1].Old != "c, d.txt" || mappings[1].New != "e.txt" {
+			t.Errorf("%s: unexpected mappings %+v", name, mappings)
+		}
+	}
+
+	if _, err := ReadMapping(writeMapping(t, "bad.csv", "a.txt,b.txt,c.txt\n")); err == nil {
+		t.Error("expected an error for a row with three fields")
+	}
+}
+
+func TestApplyMappingCycle(t *testing.T) {
+	db := setupTestDB(t)
+	dir := t.TempDir()
+	createFiles(t, dir, "a.txt", "b.txt", "c.txt")
+	mapPath := writeMapping(t, "renames.csv", "a.txt,b.txt\nb.txt,a.txt\n"+filepath.Join(dir, "c.txt")+",d.txt\n")
+
+	if err := ApplyMapping(db, dir, mapPath, ConflictAbort, false, ""); err != nil {
+		t.Fatalf("ApplyMapping failed: %v", err)
+	}
+	expected := map[string]string{"a.txt": "b.txt", "b.txt": "a.txt", "d.txt": "c.txt"}
+	for name, content := range expected {
+		if got := readFile(t, filepath.Join(dir, name)); got != content {
+			t.Errorf("%s: expected content %q, got %q", name, content, got)
+		}
+	}
+
+	if err := Undo(db, dir, 1, false); err != nil {
+		t.Fatalf("Undo failed: %v", err)
+	}
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		if got := readFile(t, filepath.Join(dir, name)); got != name {
+			t.Errorf("%s: expected content %q after undo, got %q", name, name, got)
+		}
+	}
+}
+
+func TestPlanMappingValidation(t *testing.T) {
+	dir := t.TempDir()
+	createFiles(t, dir, "a.txt", "b.txt", "taken.txt")
+
+	mappings := []Mapping{
+		{Old: "missing.txt", New: "x.txt", Line: 1},
+		{Old: "a.txt", New: "c.txt", Line: 2},
+		{Old: "a.txt", New: "d.txt", Line: 3},
+		{Old: "b.txt", New: "c.txt", Line: 4},
+		{Old: "b.txt", New: "../out.txt", Line: 5},
+		{Old: "b.txt", New: "", Line: 6},
+	}
+	_, err := PlanMapping(dir, mappings, ConflictAbort)
+	if err == nil {
+		t.Fatal("expected the mapping to be rejected")
+	}
+	for _, message := range []string{
+		"line 1: missing.txt does not exist",
+		"line 3: a.txt is already renamed on line 2",
+		"line 4: c.txt is already the new name on line 2",
+		"line 5: ../out.txt is outside",
+		"line 6: both the old and the new name are required",
+	} {
+		if !strings.Contains(err.Error(), message) {
+			t.Errorf("expected %q in %v", message, err)
+		}
+	}
+
+	// Existing files that are not renamed away are left to the conflict policy.
+	if _, err := PlanMapping(dir, []Mapping{{Old: "a.txt", New: "taken.txt", Line: 1}}, ConflictAbort); err == nil {
+		t.Error("expected a conflict with taken.txt")
+	}
+}
+
+func TestWithinRoot(t *testing.T) {
+	root := string(filepath.Separator)
+	if !withinRoot(root, filepath.Join(root, "a.txt")) {
+		t.Error("expected a file below the file system root to be within it")
+	}
+	dir := t.TempDir()
+	if withinRoot(dir, dir) || withinRoot(dir, dir+"x") || withinRoot(dir, filepath.Dir(dir)) {
+		t.Error("expected only paths below the root to be within it")
+	}
+}
@@ -0,0 +1,311 @@
+package cleaner
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// SchemaMigration records a migration that has been applied to the database
+type SchemaMigration struct {
+	Version   int `gorm:"primaryKey;autoIncrement:false"`
+	Name      string
+	AppliedAt time.Time
+}
+
+// migration changes the schema from version-1 to version. Migrations must not
+// use the live models, which keep changing; they declare the tables as they
+// looked at that version.
+type migration struct {
+	version int
+	name    string
+	up      func(tx *gorm.DB) error
+}
+
+// migrations lists every schema change in order. Never edit or reorder an
+// entry once released; add a new one instead.
+var migrations = []migration{
+	{1, "create rename_histories and journal_entries", migrateV1},
+	{2, "move batch metadata from rename_histories to batches", migrateV2},
+	{3, "add file fingerprints to rename_histories", migrateV3},
+	{4, "add per-entry state to rename_histories", migrateV4},
+}
+
+// renameHistoryV1 is rename_histories as created by AutoMigrate before
+// versioned migrations existed, plus reverted_at.
+type renameHistoryV1 struct {
+	ID            uint `gorm:"primaryKey"`
+	OriginalPath  string
+	NewPath       string
+	Operation     string
+	BatchID       string
+	CreatedAt     time.Time
+	Reverted      bool
+	Redone        bool
+	RevertedAt    *time.Time
+	OperationType string
+}
+
+func (renameHistoryV1) TableName() string { return "rename_histories" }
+
+type journalEntryV1 struct {
+	ID        uint   `gorm:"primaryKey"`
+	BatchID   string `gorm:"index:idx_journal_entries_batch_id"`
+	Operation string
+	Reverts   string
+	Root      string
+	Seq       int
+	FromPath  string
+	ToPath    string
+	Source    string
+	Target    string
+	Final     bool
+	Done      bool
+	CreatedAt time.Time
+}
+
+func (journalEntryV1) TableName() string { return "journal_entries" }
+
+// migrateV1 creates the baseline schema. Databases from older versions
+// already have rename_histories; AutoMigrate only adds what is missing.
+func migrateV1(tx *gorm.DB) error {
+	return tx.AutoMigrate(&renameHistoryV1{}, &journalEntryV1{})
+}
+
+type batchV2 struct {
+	ID          string `gorm:"primaryKey"`
+	Operation   string
+	Status      string `gorm:"index:idx_batches_status"`
+	Directory   string
+	CommandLine string
+	Options     string
+	User        string
+	Hostname    string
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	UndoneAt    *time.Time
+}
+
+func (batchV2) TableName() string { return "batches" }
+
+type renameHistoryV2 struct {
+	ID           uint   `gorm:"primaryKey"`
+	BatchID      string `gorm:"index:idx_rename_histories_batch_id"`
+	OriginalPath string
+	NewPath      string
+}
+
+func (renameHistoryV2) TableName() string { return "rename_histories" }
+
+// migrateV2 creates one batches row per batch_id, carrying over the columns
+// every entry used to repeat, and then drops them from rename_histories.
+func migrateV2(tx *gorm.DB) error {
+	if err := tx.AutoMigrate(&batchV2{}); err != nil {
+		return err
+	}
+
+	var rows []renameHistoryV1
+	if err := tx.Order("id").Find(&rows).Error; err != nil {
+		return err
+	}
+	var batches []batchV2
+	index := make(map[string]int)
+	for _, r := range rows {
+		i, ok := index[r.BatchID]
+		if !ok {
+			status := StatusApplied
+			if r.Reverted {
+				status = StatusUndone
+			} else if r.Redone {
+				status = StatusRedone
+			}
+			i = len(batches)
+			index[r.BatchID] = i
+			batches = append(batches, batchV2{
+				ID:        r.BatchID,
+				Operation: r.Operation,
+				Status:    status,
+				Directory: filepath.Dir(r.OriginalPath),
+				CreatedAt: r.CreatedAt,
+				UpdatedAt: r.CreatedAt,
+				UndoneAt:  r.RevertedAt,
+			})
+		}
+		b := &batches[i]
+		b.Directory = commonDir(b.Directory, filepath.Dir(r.OriginalPath))
+		if r.CreatedAt.Before(b.CreatedAt) {
+			b.CreatedAt = r.CreatedAt
+		}
+	}
+	if len(batches) > 0 {
+		if err := tx.CreateInBatches(&batches, 100).Error; err != nil {
+			return err
+		}
+	}
+
+	for _, column := range []string{"operation", "created_at", "reverted", "redone", "reverted_at", "operation_type"} {
+		if tx.Migrator().HasColumn(&renameHistoryV1{}, column) {
+			if err := tx.Migrator().DropColumn(&renameHistoryV1{}, column); err != nil {
+				return err
+			}
+		}
+	}
+	return tx.AutoMigrate(&renameHistoryV2{})
+}
+
+type renameHistoryV3 struct {
+	ID           uint   `gorm:"primaryKey"`
+	BatchID      string `gorm:"index:idx_rename_histories_batch_id"`
+	OriginalPath string
+	NewPath      string
+	Size         int64  `gorm:"not null;default:0"`
+	ModTime      int64  `gorm:"not null;default:0"`
+	Hash         string `gorm:"not null;default:''"`
+}
+
+func (renameHistoryV3) TableName() string { return "rename_histories" }
+
+// migrateV3 adds size, mod_time and hash. Existing entries keep zero values,
+// which undo treats as "not recorded".
+func migrateV3(tx *gorm.DB) error {
+	return tx.AutoMigrate(&renameHistoryV3{})
+}
+
+type renameHistoryV4 struct {
+	renameHistoryV3
+	State string `gorm:"not null;default:'applied'"`
+}
+
+func (renameHistoryV4) TableName() string { return "rename_histories" }
+
+// migrateV4 adds state. Entries of undone batches are undone; the entries of
+// partial batches cannot be told apart and count as applied.
+func migrateV4(tx *gorm.DB) error {
+	if err := tx.AutoMigrate(&renameHistoryV4{}); err != nil {
+		return err
+	}
+	return tx.Exec("UPDATE rename_histories SET state = ? WHERE batch_id IN (SELECT id FROM batches WHERE status = ?)",
+		StatusUndone, StatusUndone).Error
+}
+
+// LatestSchemaVersion is the schema version this build of nametidy expects
+func LatestSchemaVersion() int {
+	return migrations[len(migrations)-1].version
+}
+
+// SchemaVersion returns the version of the database schema, 0 for a new or
+// pre-versioning database
+func SchemaVersion(db *gorm.DB) (int, error) {
+	if !db.Migrator().HasTable(&SchemaMigration{}) {
+		return 0, nil
+	}
+	var version int
+	err := db.Model(&SchemaMigration{}).Select("COALESCE(MAX(version), 0)").Scan(&version).Error
+	return version, err
+}
+
+// PendingMigrations returns the names of the migrations not yet applied
+func PendingMigrations(db *gorm.DB) ([]string, error) {
+	version, err := SchemaVersion(db)
+	if err != nil {
+		return nil, err
+	}
+	if version > LatestSchemaVersion() {
+		return nil, fmt.Errorf("database schema version %d is newer than this nametidy supports (%d); please upgrade nametidy", version, LatestSchemaVersion())
+	}
+
+	var pending []string
+	for _, m := range migrations {
+		if m.version > version {
+			pending = append(pending, fmt.Sprintf("%d: %s", m.version, m.name))
+		}
+	}
+	return pending, nil
+}
+
+// Migrate applies the pending migrations, each in its own transaction, and
+// returns their names. With dryRun it only reports them.
+func Migrate(db *gorm.DB, dryRun bool) ([]string, error) {
+	pending, err := PendingMigrations(db)
+	if err != nil || dryRun || len(pending) == 0 {
+		return pending, err
+	}
+	if err := db.AutoMigrate(&SchemaMigration{}); err != nil {
+		return nil, err
+	}
+
+	version, err := SchemaVersion(db)
+	if err != nil {
+		return nil, err
+	}
+	var applied []string
+	for _, m := range migrations {
+		if m.version <= version {
+			continue
+		}
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := m.up(tx); err != nil {
+				return err
+			}
+			return tx.Create(&SchemaMigration{Version: m.version, Name: m.name, AppliedAt: time.Now()}).Error
+		})
+		if err != nil {
+			return applied, fmt.Errorf("migration %d (%s) failed: %v", m.version, m.name, err)
+		}
+		applied = append(applied, fmt.Sprintf("%d: %s", m.version, m.name))
+	}
+	return applied, nil
+}
+
+// DBStatus is the result of CheckDB
+type DBStatus struct {
+	Version   int
+	Latest    int
+	Pending   []string
+	Integrity string   // "ok" or the problems reported by SQLite
+	Missing   []string // tables or columns the current models need but the DB lacks
+}
+
+// CheckDB inspects the schema version and integrity without changing anything
+func CheckDB(db *gorm.DB) (DBStatus, error) {
+	status := DBStatus{Latest: LatestSchemaVersion()}
+	var err error
+	if status.Version, err = SchemaVersion(db); err != nil {
+		return status, err
+	}
+	if status.Version <= status.Latest {
+		if status.Pending, err = PendingMigrations(db); err != nil {
+			return status, err
+		}
+	}
+
+	var results []string
+	if err := db.Raw("PRAGMA integrity_check").Scan(&results).Error; err != nil {
+		return status, err
+	}
+	status.Integrity = fmt.Sprint(results)
+	if len(results) == 1 {
+		status.Integrity = results[0]
+	}
+
+	if len(status.Pending) == 0 {
+		for _, model := range []interface{}{&Batch{}, &RenameHistory{}, &JournalEntry{}} {
+			stmt := &gorm.Statement{DB: db}
+			if err := stmt.Parse(model); err != nil {
+				return status, err
+			}
+			if !db.Migrator().HasTable(model) {
+				status.Missing = append(status.Missing, stmt.Schema.Table)
+				continue
+			}
+			for _, field := range stmt.Schema.DBNames {
+				if !db.Migrator().HasColumn(model, field) {
+					status.Missing = append(status.Missing, stmt.Schema.Table+"."+field)
+				}
+			}
+		}
+	}
+	return status, nil
+}
@@ -0,0 +1,121 @@
+package cleaner
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// legacyHistory is rename_histories as created by AutoMigrate in releases
+// without versioned migrations
+type legacyHistory struct {
+	ID            uint `gorm:"primaryKey"`
+	OriginalPath  string
+	NewPath       string
+	Operation     string
+	BatchID       string
+	CreatedAt     time.Time
+	Reverted      bool
+	Redone        bool
+	OperationType string
+}
+
+func (legacyHistory) TableName() string { return "rename_histories" }
+
+func TestMigrateLegacyDatabase(t *testing.T) {
+	db, err := OpenDB(filepath.Join(t.TempDir(), "history.db"))
+	if err != nil {
+		t.Fatalf("OpenDB failed: %v", err)
+	}
+	if err := db.AutoMigrate(&legacyHistory{}); err != nil {
+		t.Fatalf("failed to create legacy schema: %v", err)
+	}
+	legacy := legacyHistory{OriginalPath: "/a b.txt", NewPath: "/a_b.txt", Operation: "clean", BatchID: "clean-1", CreatedAt: time.Now()}
+	if err := db.Create(&legacy).Error; err != nil {
+		t.Fatalf("failed to insert legacy history: %v", err)
+	}
+
+	if version, _ := SchemaVersion(db); version != 0 {
+		t.Fatalf("expected legacy database to be version 0, got %d", version)
+	}
+	applied, err := Migrate(db, false)
+	if err != nil || len(applied) != len(migrations) {
+		t.Fatalf("expected every migration to be applied, got %v (%v)", applied, err)
+	}
+	if version, _ := SchemaVersion(db); version != LatestSchemaVersion() {
+		t.Errorf("expected version %d, got %d", LatestSchemaVersion(), version)
+	}
+
+	histories, err := GetHistoriesByBatch(db, "clean-1")
+	if err != nil || len(histories) != 1 || histories[0].NewPath != "/a_b.txt" {
+		t.Errorf("legacy history was not preserved: %+v (%v)", histories, err)
+	}
+	batch, err := GetBatch(db, "clean-1")
+	if err != nil || batch.Operation != "clean" || batch.Status != StatusApplied || batch.Directory != "/" {
+		t.Errorf("legacy batch was not created: %+v (%v)", batch, err)
+	}
+	if db.Migrator().HasColumn("rename_histories", "operation") {
+		t.Error("expected the per-entry operation column to be dropped")
+	}
+
+	status, err := CheckDB(db)
+	if err != nil {
+		t.Fatalf("CheckDB failed: %v", err)
+	}
+	if status.Integrity != "ok" || len(status.Pending) != 0 || len(status.Missing) != 0 {
+		t.Errorf("unexpected status after migration: %+v", status)
+	}
+
+	// Running again is a no-op.
+	if applied, err := Migrate(db, false); err != nil || len(applied) != 0 {
+		t.Errorf("expected no pending migrations, got %v (%v)", applied, err)
+	}
+}
+
+func TestMigrateRejectsNewerDatabase(t *testing.T) {
+	db := setupTestDB(t)
+	future := SchemaMigration{Version: LatestSchemaVersion() + 1, Name: "from the future", AppliedAt: time.Now()}
+	if err := db.Create(&future).Error; err != nil {
+		t.Fatalf("failed to insert migration: %v", err)
+	}
+	if _, err := Migrate(db, false); err == nil {
+		t.Error("expected Migrate to refuse a newer schema")
+	}
+}
+
+func TestCheckDBLegacyDatabase(t *testing.T) {
+	db, err := OpenDB(filepath.Join(t.TempDir(), "history.db"))
+	if err != nil {
+		t.Fatalf("OpenDB failed: %v", err)
+	}
+	if err := db.AutoMigrate(&legacyHistory{}); err != nil {
+		t.Fatalf("failed to create legacy schema: %v", err)
+	}
+
+	// The columns are only compared once every migration has run.
+	status, err := CheckDB(db)
+	if err != nil {
+		t.Fatalf("CheckDB failed: %v", err)
+	}
+	if status.Version != 0 || status.Latest != LatestSchemaVersion() || len(status.Pending) != len(migrations) {
+		t.Errorf("expected every migration to be pending, got %+v", status)
+	}
+	if status.Integrity != "ok" || len(status.Missing) != 0 {
+		t.Errorf("unexpected status for a legacy database: %+v", status)
+	}
+}
+
+func TestCheckDBMissingColumn(t *testing.T) {
+	db := setupTestDB(t)
+	if err := db.Migrator().DropColumn(&RenameHistory{}, "NewPath"); err != nil {
+		t.Fatalf("failed to drop column: %v", err)
+	}
+
+	status, err := CheckDB(db)
+	if err != nil {
+		t.Fatalf("CheckDB failed: %v", err)
+	}
+	if len(status.Pending) != 0 || len(status.Missing) != 1 || status.Missing[0] != "rename_histories.new_path" {
+		t.Errorf("expected only rename_histories.new_path to be missing, got %+v", status)
+	}
+}
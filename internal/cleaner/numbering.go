@@ -1,26 +1,47 @@
 package cleaner
 
 import (
-	"nametidy/internal/utils"
 	"fmt"
 	"os"
 	"path/filepath"
-	"time"
+	"strconv"
+
+	"nametidy/internal/utils"
 
 	"gorm.io/gorm"
 )
 
-func NumberFiles(db *gorm.DB, dirPath string, digits int, hierarchical bool, dryRun bool) error {
+func NumberFiles(db *gorm.DB, dirPath string, digits int, hierarchical bool, policy ConflictPolicy, dryRun bool, planOut string) error {
+	plan, err := PlanNumber(dirPath, digits, hierarchical, policy)
+	if err != nil {
+		return err
+	}
+	return execute(db, plan, dryRun, planOut)
+}
+
+// PlanNumber builds the rename plan for adding sequence numbers under dirPath
+func PlanNumber(dirPath string, digits int, hierarchical bool, policy ConflictPolicy) (*Plan, error) {
+	root, err := absPath(dirPath)
+	if err != nil {
+		return nil, err
+	}
 	counts := make(map[string]int)
-	batchID := fmt.Sprintf("number-%d", time.Now().UnixNano())
-	histories := []RenameHistory{}
+	plan := NewPlan("number", root)
+	plan.Options = map[string]string{
+		"digits":       strconv.Itoa(digits),
+		"hierarchical": strconv.FormatBool(hierarchical),
+		"on_conflict":  string(policy),
+	}
 
-	err := filepath.Walk(dirPath, func(path string, info os.FileInfo, err error) error {
+	err = filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
 
 		if info.IsDir() {
+			if info.Name() == LOCAL_DB_DIR {
+				return filepath.SkipDir
+			}
 			return nil
 		}
 
@@ -38,30 +59,15 @@ func NumberFiles(db *gorm.DB, dirPath string, digits int, hierarchical bool, dry
 			return err
 		}
 
-		if dryRun {
-			fmt.Printf("[DRY-RUN] %s → %s\n", path, newPath)
-		} else {
-			if err := os.Rename(path, newPath); err != nil {
-				return fmt.Errorf("failed to rename the file: %v", err)
-			}
-			fmt.Printf("Renamed: %s → %s\n", path, newPath)
-			histories = append(histories, RenameHistory{
-				OriginalPath: path,
-				NewPath:      newPath,
-				Operation:    "number",
-				BatchID:      batchID,
-				CreatedAt:    time.Now(),
-			})
-		}
+		plan.AddName(path, filepath.Base(newPath), fmt.Sprintf("sequence number %d", count))
 		return nil
 	})
-
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	if !dryRun && len(histories) > 0 {
-		return db.Create(&histories).Error
+	if err := plan.Resolve(policy); err != nil {
+		return nil, err
 	}
-	return nil
+	return plan, nil
 }
@@ -0,0 +1,322 @@
+package cleaner
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"nametidy/internal/utils"
+
+	"gorm.io/gorm"
+)
+
+// PlanEntry is a single rename inside a Plan
+type PlanEntry struct {
+	Source    string   `json:"source"`
+	Target    string   `json:"target"`
+	Reason    string   `json:"reason,omitempty"`
+	Conflicts []string `json:"conflicts,omitempty"`
+	Skipped   bool     `json:"skipped,omitempty"`
+}
+
+// conflict returns the last reason the entry was skipped for, or ""
+func (e PlanEntry) conflict() string {
+	if len(e.Conflicts) == 0 {
+		return ""
+	}
+	return e.Conflicts[len(e.Conflicts)-1]
+}
+
+// Plan is the full list of renames an operation wants to make. It is built
+// without touching the file system and applied afterwards, so it can be
+// printed for --dry-run or recorded in the history as-is.
+type Plan struct {
+	Operation string            `json:"operation"`
+	BatchID   string            `json:"batch_id"`
+	Reverts   string            `json:"reverts,omitempty"` // batch undone or redone by this plan
+	Root      string            `json:"root"`
+	Options   map[string]string `json:"options,omitempty"`
+	Entries   []PlanEntry       `json:"entries"`
+
+	moves dryRunMoves // renames planned before this plan in a dry run
+}
+
+// NewPlan creates an empty plan for the given operation
+func NewPlan(operation, root string) *Plan {
+	return &Plan{
+		Operation: operation,
+		BatchID:   fmt.Sprintf("%s-%d", operation, time.Now().UnixNano()),
+		Root:      root,
+	}
+}
+
+// Add appends a rename to the plan. Renames that would not change the path
+// are ignored.
+func (p *Plan) Add(source, target, reason string) {
+	if source == target {
+		return
+	}
+	p.Entries = append(p.Entries, PlanEntry{Source: source, Target: target, Reason: reason})
+}
+
+// Skip appends a rename that will not be applied, keeping the reason visible
+// in the plan output.
+func (p *Plan) Skip(source, target, conflict string) {
+	p.Entries = append(p.Entries, PlanEntry{Source: source, Target: target, Conflicts: []string{conflict}, Skipped: true})
+}
+
+// AddName appends a rename of source to newName in the same directory. Names
+// that cannot be used, such as one cleaned down to nothing, are skipped with
+// a warning instead.
+func (p *Plan) AddName(source, newName, reason string) {
+	target := filepath.Join(filepath.Dir(source), newName)
+	if problem := invalidName(filepath.Base(source), newName); problem != "" {
+		utils.Warn(fmt.Sprintf("Skipped: %s → %s (%s)", displayPath(source), displayPath(target), problem))
+		p.Skip(source, target, problem)
+		return
+	}
+	p.Add(source, target, reason)
+}
+
+// invalidName tells why newName cannot replace oldName, or returns ""
+func invalidName(oldName, newName string) string {
+	switch {
+	case newName == "" || newName == "." || newName == "..":
+		return "new name is empty"
+	case strings.ContainsRune(newName, '/') || strings.ContainsRune(newName, filepath.Separator):
+		return "new name contains a path separator"
+	case stem(newName) == "" && stem(oldName) != "":
+		// "Москва.jpg" → ".jpg" would turn the file into a hidden one
+		return "new name is empty"
+	}
+	return ""
+}
+
+// stem returns name without its extension
+func stem(name string) string {
+	return strings.TrimSuffix(name, filepath.Ext(name))
+}
+
+// Renames returns the entries that will actually be applied
+func (p *Plan) Renames() []PlanEntry {
+	renames := make([]PlanEntry, 0, len(p.Entries))
+	for _, e := range p.Entries {
+		if !e.Skipped {
+			renames = append(renames, e)
+		}
+	}
+	return renames
+}
+
+// Print writes the plan in the --dry-run format
+func (p *Plan) Print(w io.Writer) {
+	for _, e := range p.Entries {
+		if e.Skipped {
+			fmt.Fprintf(w, "[DRY-RUN] [SKIP] %s → %s (%s)\n", displayPath(e.Source), displayPath(e.Target), e.conflict())
+			continue
+		}
+		fmt.Fprintf(w, "[DRY-RUN] %s → %s\n", displayPath(e.Source), displayPath(e.Target))
+	}
+}
+
+// displayPath shortens an absolute path to one relative to the working
+// directory when it lies below it
+func displayPath(path string) string {
+	wd, err := os.Getwd()
+	if err != nil || !utils.IsWithin(wd, path) {
+		return path
+	}
+	if rel, err := filepath.Rel(wd, path); err == nil {
+		return rel
+	}
+	return path
+}
+
+// newBatch builds the history record of the plan, including who ran it and
+// how
+func (p *Plan) newBatch(status string) *Batch {
+	batch := &Batch{
+		ID:          p.BatchID,
+		Operation:   p.Operation,
+		Status:      status,
+		Directory:   p.Root,
+		CommandLine: commandLine(os.Args),
+		User:        currentUser(),
+	}
+	batch.Hostname, _ = os.Hostname()
+	if len(p.Options) > 0 {
+		options, _ := json.Marshal(p.Options)
+		batch.Options = string(options)
+	}
+	for _, e := range p.Renames() {
+		h := RenameHistory{OriginalPath: e.Source, NewPath: e.Target, State: StatusApplied}
+		if status != StatusFailed {
+			fp, err := TakeFingerprint(e.Target)
+			if err != nil {
+				utils.Warn(fmt.Sprintf("Failed to fingerprint %s: %v", displayPath(e.Target), err))
+			}
+			h.Fingerprint = fp
+		}
+		batch.Entries = append(batch.Entries, h)
+	}
+	return batch
+}
+
+// record writes the outcome of an applied plan to the history
+func (p *Plan) record(tx *gorm.DB) error {
+	if p.Operation == "undo" || p.Operation == "redo" {
+		return p.recordReplay(tx)
+	}
+
+	batch := p.newBatch(StatusApplied)
+	if len(batch.Entries) == 0 {
+		return nil
+	}
+	if err := p.discardRedoBranch(tx); err != nil {
+		return err
+	}
+	// A batch whose rollback got stuck was recorded as failed; finishing it
+	// with Recover replaces that record.
+	if err := tx.Where("id = ? AND status = ?", p.BatchID, StatusFailed).Delete(&Batch{}).Error; err != nil {
+		return err
+	}
+	return tx.Create(batch).Error
+}
+
+// recordReplay moves the replayed entries to their new state and derives the
+// batch status from the states of all its entries
+func (p *Plan) recordReplay(tx *gorm.DB) error {
+	renames := p.Renames()
+	if len(renames) == 0 {
+		return nil
+	}
+
+	state, status := StatusApplied, StatusRedone
+	updates := map[string]interface{}{}
+	if p.Operation == "undo" {
+		state, status = StatusUndone, StatusUndone
+		updates["undone_at"] = time.Now()
+	}
+	for _, e := range renames {
+		// Entries are matched by path so plans rebuilt from the journal work too
+		original, renamed := e.Source, e.Target
+		if p.Operation == "undo" {
+			original, renamed = renamed, original
+		}
+		err := tx.Model(&RenameHistory{}).
+			Where("batch_id = ? AND original_path = ? AND new_path = ?", p.Reverts, original, renamed).
+			Update("state", state).Error
+		if err != nil {
+			return err
+		}
+	}
+
+	var remaining int64
+	if err := tx.Model(&RenameHistory{}).Where("batch_id = ? AND state <> ?", p.Reverts, state).Count(&remaining).Error; err != nil {
+		return err
+	}
+	if remaining > 0 {
+		status = StatusPartial
+	}
+	updates["status"] = status
+	return tx.Model(&Batch{}).Where("id = ?", p.Reverts).Updates(updates).Error
+}
+
+// recordFailure keeps a trace of a batch that was rolled back so it shows up
+// in the history listing
+func (p *Plan) recordFailure(db *gorm.DB) {
+	if p.Operation == "undo" || p.Operation == "redo" {
+		return
+	}
+	batch := p.newBatch(StatusFailed)
+	batch.Entries = nil
+	if err := db.Create(batch).Error; err != nil {
+		utils.Warn(fmt.Sprintf("Failed to record failed batch %s: %v", p.BatchID, err))
+	}
+}
+
+// discardRedoBranch drops the undone batches that touched files under the
+// plan root: once a new operation is recorded they can no longer be redone,
+// the same way editors drop their redo stack.
+func (p *Plan) discardRedoBranch(tx *gorm.DB) error {
+	var undone []Batch
+	if err := tx.Preload("Entries").Where("status = ?", StatusUndone).Find(&undone).Error; err != nil {
+		return err
+	}
+
+	var batchIDs []string
+	for _, b := range undone {
+		for _, h := range b.Entries {
+			if storedWithin(p.Root, h.OriginalPath) || storedWithin(p.Root, h.NewPath) {
+				batchIDs = append(batchIDs, b.ID)
+				break
+			}
+		}
+	}
+	if len(batchIDs) == 0 {
+		return nil
+	}
+
+	utils.Info(fmt.Sprintf("Discarding %d undone batch(es) that can no longer be redone", len(batchIDs)))
+	_, err := deleteBatches(tx, batchIDs)
+	return err
+}
+
+// commandLine joins the arguments, quoting the ones that contain spaces
+func commandLine(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		if arg == "" || strings.ContainsAny(arg, " \t\"'") {
+			arg = strconv.Quote(arg)
+		}
+		quoted[i] = arg
+	}
+	return strings.Join(quoted, " ")
+}
+
+// currentUser returns the login name of the user running nametidy
+func currentUser() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	if name := os.Getenv("USER"); name != "" {
+		return name
+	}
+	return os.Getenv("USERNAME")
+}
+
+// ErrNothingToDo is returned when an operation finds no file to rename
+var ErrNothingToDo = errors.New("nothing to do")
+
+// execute prints the plan in dry-run mode, saving it to planOut for `apply
+// --plan` unless that is empty, otherwise applies it and records the batch in
+// the history.
+func execute(db *gorm.DB, plan *Plan, dryRun bool, planOut string) error {
+	if len(plan.Entries) == 0 {
+		return fmt.Errorf("%w: no file under %s needs to be renamed", ErrNothingToDo, displayPath(plan.Root))
+	}
+	if len(plan.Renames()) == 0 {
+		if dryRun {
+			plan.Print(os.Stdout)
+		}
+		return fmt.Errorf("%w: every rename under %s was skipped", ErrNothingToDo, displayPath(plan.Root))
+	}
+	if dryRun {
+		plan.Print(os.Stdout)
+		if planOut != "" {
+			if err := WritePlanFile(planOut, plan); err != nil {
+				return fmt.Errorf("failed to save the plan: %w", err)
+			}
+			fmt.Printf("Plan saved to %s; run `nametidy apply -p %s --plan %s` to apply it.\n", planOut, displayPath(plan.Root), planOut)
+		}
+		return nil
+	}
+	return plan.Commit(db)
+}
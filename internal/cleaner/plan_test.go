@@ -0,0 +1,92 @@
+package cleaner
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestPlanApplyCycle(t *testing.T) {
+	dir := t.TempDir()
+	createFiles(t, dir, "a.txt", "b.txt", "c.txt")
+	a, b, c := filepath.Join(dir, "a.txt"), filepath.Join(dir, "b.txt"), filepath.Join(dir, "c.txt")
+
+	plan := NewPlan("test", dir)
+	plan.Add(a, b, "")
+	plan.Add(b, c, "")
+	plan.Add(c, a, "")
+	if err := plan.Resolve(ConflictAbort); err != nil {
+		t.Fatalf("cycle should not be reported as a conflict: %v", err)
+	}
+	if err := plan.apply(); err != nil {
+		t.Fatalf("apply failed: %v", err)
+	}
+
+	expected := map[string]string{"b.txt": "a.txt", "c.txt": "b.txt", "a.txt": "c.txt"}
+	for name, content := range expected {
+		if got := readFile(t, filepath.Join(dir, name)); got != content {
+			t.Errorf("%s: expected content %q, got %q", name, content, got)
+		}
+	}
+}
+
+func TestPlanApplyChain(t *testing.T) {
+	dir := t.TempDir()
+	createFiles(t, dir, "a.txt", "b.txt")
+	a, b, c := filepath.Join(dir, "a.txt"), filepath.Join(dir, "b.txt"), filepath.Join(dir, "c.txt")
+
+	// a→b is listed first but has to wait until b has moved to c.
+	plan := NewPlan("test", dir)
+	plan.Add(a, b, "")
+	plan.Add(b, c, "")
+	if err := plan.Resolve(ConflictAbort); err != nil {
+		t.Fatalf("chain should not be reported as a conflict: %v", err)
+	}
+	steps := plan.steps()
+	if len(steps) != 2 || steps[0].From != b || steps[1].From != a {
+		t.Fatalf("unexpected step order: %+v", steps)
+	}
+	if err := plan.apply(); err != nil {
+		t.Fatalf("apply failed: %v", err)
+	}
+	if got := readFile(t, c); got != "b.txt" {
+		t.Errorf("c.txt: expected content %q, got %q", "b.txt", got)
+	}
+	if got := readFile(t, b); got != "a.txt" {
+		t.Errorf("b.txt: expected content %q, got %q", "a.txt", got)
+	}
+}
+
+func TestPlanResolveSkipCascades(t *testing.T) {
+	dir := t.TempDir()
+	createFiles(t, dir, "a.txt", "b.txt", "x.txt")
+	a, b, x := filepath.Join(dir, "a.txt"), filepath.Join(dir, "b.txt"), filepath.Join(dir, "x.txt")
+
+	// b→x is skipped because x exists, so b stays and a→b must be skipped too.
+	plan := NewPlan("test", dir)
+	plan.Add(a, b, "")
+	plan.Add(b, x, "")
+	if err := plan.Resolve(ConflictSkip); err != nil {
+		t.Fatalf("Resolve failed: %v", err)
+	}
+	if len(plan.Renames()) != 0 {
+		t.Fatalf("expected every rename to be skipped, got %+v", plan.Renames())
+	}
+}
+
+func TestUndoRestoresCleanBatch(t *testing.T) {
+	db := setupTestDB(t)
+	dir := t.TempDir()
+	createFiles(t, dir, "a b.txt", "c d.txt")
+
+	if err := Clean(db, dir, nil, ConflictSuffix, false, ""); err != nil {
+		t.Fatalf("Clean failed: %v", err)
+	}
+	if err := Undo(db, dir, 1, false); err != nil {
+		t.Fatalf("Undo failed: %v", err)
+	}
+	for _, name := range []string{"a b.txt", "c d.txt"} {
+		if got := readFile(t, filepath.Join(dir, name)); got != name {
+			t.Errorf("%s: expected content %q, got %q", name, name, got)
+		}
+	}
+}
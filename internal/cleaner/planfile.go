@@ -0,0 +1,191 @@
+package cleaner
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// planFileVersion is written to every plan file; ReadPlanFile rejects other
+// versions
+const planFileVersion = 1
+
+// PlanFile is a saved plan together with the state of every path it touches,
+// so it can be applied later only if nothing changed in between
+type PlanFile struct {
+	Version   int                  `json:"version"`
+	CreatedAt time.Time            `json:"created_at"`
+	Plan      *Plan                `json:"plan"`
+	Files     map[string]FileState `json:"files"`
+}
+
+// FileState is what a path looked like when the plan was made. Missing paths
+// are the targets that were free.
+type FileState struct {
+	Exists bool `json:"exists"`
+	Fingerprint
+}
+
+// WritePlanFile saves the plan and the current state of its sources and
+// targets to path
+func WritePlanFile(path string, plan *Plan) error {
+	pf := PlanFile{Version: planFileVersion, CreatedAt: time.Now(), Plan: plan, Files: make(map[string]FileState)}
+	for _, e := range plan.Renames() {
+		for _, p := range []string{e.Source, e.Target} {
+			if _, ok := pf.Files[p]; ok {
+				continue
+			}
+			state, err := currentState(p)
+			if err != nil {
+				return err
+			}
+			pf.Files[p] = state
+		}
+	}
+
+	data, err := json.MarshalIndent(pf, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// ReadPlanFile loads a plan saved by WritePlanFile
+func ReadPlanFile(path string) (*PlanFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var pf PlanFile
+	if err := json.Unmarshal(data, &pf); err != nil {
+		return nil, fmt.Errorf("%s is not a plan file: %v", path, err)
+	}
+	if pf.Version != planFileVersion {
+		return nil, fmt.Errorf("%s has plan file version %d, expected %d", path, pf.Version, planFileVersion)
+	}
+	if pf.Plan == nil || pf.Plan.Root == "" {
+		return nil, fmt.Errorf("%s holds no plan", path)
+	}
+	if op := pf.Plan.Operation; op == "undo" || op == "redo" {
+		return nil, fmt.Errorf("%s: %s plans cannot be applied from a file", path, op)
+	}
+	return &pf, nil
+}
+
+// Verify checks that every path of the plan is still as it was when the plan
+// was made and reports all differences together
+func (pf *PlanFile) Verify() error {
+	paths := make([]string, 0, len(pf.Files))
+	for p := range pf.Files {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	var problems []error
+	for _, e := range pf.Plan.Renames() {
+		if _, ok := pf.Files[e.Source]; !ok {
+			problems = append(problems, fmt.Errorf("%s: not recorded in the plan file", e.Source))
+		}
+	}
+	for _, p := range paths {
+		recorded := pf.Files[p]
+		_, err := os.Lstat(p)
+		switch {
+		case err != nil && !os.IsNotExist(err):
+			problems = append(problems, fmt.Errorf("%s: %v", p, err))
+		case recorded.Exists && err != nil:
+			problems = append(problems, fmt.Errorf("%s: %s", p, reasonMissing))
+		case !recorded.Exists && err == nil:
+			problems = append(problems, fmt.Errorf("%s: created since the plan was made", p))
+		case recorded.Exists:
+			diff, err := recorded.Fingerprint.Verify(p)
+			if err != nil {
+				problems = append(problems, fmt.Errorf("%s: %v", p, err))
+			} else if diff != "" {
+				problems = append(problems, fmt.Errorf("%s: %s", p, diff))
+			}
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("the files changed since the plan was made:\n%w", errors.Join(problems...))
+	}
+	return nil
+}
+
+// ApplyPlanFile executes the plan saved at path after checking that it was
+// made for dirPath and that none of its files changed since. The renames are
+// recorded as a new batch of the plan's operation.
+func ApplyPlanFile(db *gorm.DB, dirPath, path string, dryRun bool, planOut string) error {
+	pf, err := ReadPlanFile(path)
+	if err != nil {
+		return err
+	}
+	root, err := absPath(dirPath)
+	if err != nil {
+		return err
+	}
+	if pf.Plan.Root != root {
+		return fmt.Errorf("the plan was made for %s, not %s", pf.Plan.Root, root)
+	}
+	if err := pf.check(); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	if err := pf.Verify(); err != nil {
+		return err
+	}
+	// The file may have been edited since it was written, so the renames are
+	// checked against each other and the disk as a fresh plan would be.
+	if err := pf.Plan.Resolve(ConflictAbort); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	plan := pf.Plan
+	plan.BatchID = NewPlan(plan.Operation, plan.Root).BatchID
+	if plan.Options == nil {
+		plan.Options = make(map[string]string)
+	}
+	plan.Options["plan"] = path
+	return execute(db, plan, dryRun, planOut)
+}
+
+// check rejects renames that leave the plan root, sources that are renamed
+// twice and skipped entries without a reason
+func (pf *PlanFile) check() error {
+	root := pf.Plan.Root
+	for _, e := range pf.Plan.Entries {
+		if e.Skipped && len(e.Conflicts) == 0 {
+			return fmt.Errorf("%s is skipped without a reason", e.Source)
+		}
+	}
+	sources := make(map[string]bool)
+	for _, e := range pf.Plan.Renames() {
+		for _, p := range []string{e.Source, e.Target} {
+			if p != filepath.Clean(p) || !withinRoot(root, p) {
+				return fmt.Errorf("%s is outside %s", p, root)
+			}
+		}
+		if sources[e.Source] {
+			return fmt.Errorf("%s is renamed more than once", e.Source)
+		}
+		sources[e.Source] = true
+	}
+	return nil
+}
+
+// currentState reads the state of path for a plan file
+func currentState(path string) (FileState, error) {
+	if _, err := os.Lstat(path); os.IsNotExist(err) {
+		return FileState{}, nil
+	}
+	fp, err := TakeFingerprint(path)
+	if err != nil {
+		return FileState{}, err
+	}
+	return FileState{Exists: true, Fingerprint: fp}, nil
+}
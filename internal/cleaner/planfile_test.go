@@ -0,0 +1,106 @@
+package cleaner
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestApplyPlanFile(t *testing.T) {
+	db := setupTestDB(t)
+	dir := t.TempDir()
+	createFiles(t, dir, "a b.txt", "c d.txt")
+	planPath := filepath.Join(t.TempDir(), "plan.json")
+
+	if err := Clean(db, dir, nil, ConflictSuffix, true, planPath); err != nil {
+		t.Fatalf("Clean failed: %v", err)
+	}
+	assertFiles(t, dir, "a b.txt", "c d.txt")
+
+	if err := ApplyPlanFile(db, t.TempDir(), planPath, false, ""); err == nil || !strings.Contains(err.Error(), "the plan was made for") {
+		t.Errorf("expected the plan to be refused for another directory, got %v", err)
+	}
+
+	if err := ApplyPlanFile(db, dir, planPath, false, ""); err != nil {
+		t.Fatalf("ApplyPlanFile failed: %v", err)
+	}
+	assertFiles(t, dir, "a_b.txt", "c_d.txt")
+
+	// The batch is recorded as the operation that made the plan.
+	ids, err := GetUndoableBatches(db, dir, 10)
+	if err != nil || len(ids) != 1 || !strings.HasPrefix(ids[0], "clean-") {
+		t.Fatalf("expected one undoable clean batch, got %v (%v)", ids, err)
+	}
+
+	// Applying the same plan again finds the files moved.
+	if err := ApplyPlanFile(db, dir, planPath, false, ""); err == nil || !strings.Contains(err.Error(), "changed since the plan was made") {
+		t.Errorf("expected a second apply to be refused, got %v", err)
+	}
+}
+
+func TestApplyPlanFileRefusesChanges(t *testing.T) {
+	db := setupTestDB(t)
+	dir := t.TempDir()
+	createFiles(t, dir, "a b.txt", "c d.txt")
+
+	plan, err := PlanClean(dir, nil, ConflictSuffix)
+	if err != nil {
+		t.Fatalf("PlanClean failed: %v", err)
+	}
+	planPath := filepath.Join(t.TempDir(), "plan.json")
+	if err := WritePlanFile(planPath, plan); err != nil {
+		t.Fatalf("WritePlanFile failed: %v", err)
+	}
+
+	// One source grew and one target was taken after the plan was made.
+	if err := os.WriteFile(filepath.Join(dir, "a b.txt"), []byte("longer content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	createFiles(t, dir, "c_d.txt")
+
+	err = ApplyPlanFile(db, dir, planPath, false, "")
+	if err == nil {
+		t.Fatal("expected the changed plan to be refused")
+	}
+	for _, message := range []string{"a b.txt: size changed", "c_d.txt: created since the plan was made"} {
+		if !strings.Contains(err.Error(), message) {
+			t.Errorf("expected %q in %v", message, err)
+		}
+	}
+	assertFiles(t, dir, "a b.txt", "c d.txt")
+}
+
+func TestApplyPlanFileRefusesInvalidPlans(t *testing.T) {
+	db := setupTestDB(t)
+	dir := t.TempDir()
+	createFiles(t, dir, "a.txt", "b.txt")
+	a, b := filepath.Join(dir, "a.txt"), filepath.Join(dir, "b.txt")
+
+	tests := []struct {
+		name    string
+		entries []PlanEntry
+		message string
+	}{
+		{"same target", []PlanEntry{{Source: a, Target: filepath.Join(dir, "c.txt")}, {Source: b, Target: filepath.Join(dir, "c.txt")}}, "target is used by another rename"},
+		{"same source", []PlanEntry{{Source: a, Target: filepath.Join(dir, "c.txt")}, {Source: a, Target: filepath.Join(dir, "d.txt")}}, "renamed more than once"},
+		{"outside root", []PlanEntry{{Source: a, Target: filepath.Join(filepath.Dir(dir), "a.txt")}}, "is outside"},
+		{"parent reference", []PlanEntry{{Source: a, Target: dir + "/../a.txt"}}, "is outside"},
+		{"skip without reason", []PlanEntry{{Source: a, Target: filepath.Join(dir, "c.txt"), Skipped: true}, {Source: b, Target: filepath.Join(dir, "d.txt")}}, "skipped without a reason"},
+	}
+	for _, test := range tests {
+		// Written without Resolve, as if the plan file had been edited by hand
+		plan := NewPlan("clean", dir)
+		plan.Entries = test.entries
+		planPath := filepath.Join(t.TempDir(), "plan.json")
+		if err := WritePlanFile(planPath, plan); err != nil {
+			t.Fatalf("%s: WritePlanFile failed: %v", test.name, err)
+		}
+
+		err := ApplyPlanFile(db, dir, planPath, false, "")
+		if err == nil || !strings.Contains(err.Error(), test.message) {
+			t.Errorf("%s: expected an error containing %q, got %v", test.name, test.message, err)
+		}
+		assertFiles(t, dir, "a.txt", "b.txt")
+	}
+}
@@ -0,0 +1,59 @@
+package cleaner
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"gorm.io/gorm"
+)
+
+func RenameFiles(db *gorm.DB, dirPath string, tmpl *Template, policy ConflictPolicy, dryRun bool, planOut string) error {
+	plan, err := PlanRename(dirPath, tmpl, policy)
+	if err != nil {
+		return err
+	}
+	return execute(db, plan, dryRun, planOut)
+}
+
+// PlanRename builds the rename plan for giving every file under dirPath the
+// name produced by tmpl. {counter} numbers the files in walk order.
+func PlanRename(dirPath string, tmpl *Template, policy ConflictPolicy) (*Plan, error) {
+	root, err := absPath(dirPath)
+	if err != nil {
+		return nil, err
+	}
+	plan := NewPlan("rename", root)
+	plan.Options = map[string]string{"template": tmpl.String(), "on_conflict": string(policy)}
+	reason := "template " + tmpl.String()
+	counter := 0
+
+	err = filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() {
+			if info.Name() == LOCAL_DB_DIR {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		counter++
+		newName, err := tmpl.Expand(path, info, counter)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		plan.AddName(path, newName, reason)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := plan.Resolve(policy); err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
@@ -0,0 +1,55 @@
+package cleaner
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"gorm.io/gorm"
+)
+
+func Replace(db *gorm.DB, dirPath string, from *regexp.Regexp, to string, policy ConflictPolicy, dryRun bool, planOut string) error {
+	plan, err := PlanReplace(dirPath, from, to, policy)
+	if err != nil {
+		return err
+	}
+	return execute(db, plan, dryRun, planOut)
+}
+
+// PlanReplace builds the rename plan for replacing every match of from in the
+// file names under dirPath with to, which may refer to capture groups as $1 or
+// ${name} (see regexp.Regexp.Expand). The whole name, extension included, is
+// matched.
+func PlanReplace(dirPath string, from *regexp.Regexp, to string, policy ConflictPolicy) (*Plan, error) {
+	root, err := absPath(dirPath)
+	if err != nil {
+		return nil, err
+	}
+	plan := NewPlan("replace", root)
+	plan.Options = map[string]string{"from": from.String(), "to": to, "on_conflict": string(policy)}
+	reason := "replace " + from.String() + " with " + to
+
+	err = filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() {
+			if info.Name() == LOCAL_DB_DIR {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		plan.AddName(path, from.ReplaceAllString(info.Name(), to), reason)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := plan.Resolve(policy); err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
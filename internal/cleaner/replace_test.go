@@ -0,0 +1,53 @@
+package cleaner
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+)
+
+func TestReplaceCaptureGroups(t *testing.T) {
+	db := setupTestDB(t)
+	dir := t.TempDir()
+	createFiles(t, dir, "IMG_0001.jpg", "IMG_0002.jpg", "notes.txt")
+
+	re := regexp.MustCompile(`^IMG_(?P<num>\d+)`)
+	if err := Replace(db, dir, re, "photo_${num}", ConflictSuffix, false, ""); err != nil {
+		t.Fatalf("Replace failed: %v", err)
+	}
+	assertFiles(t, dir, "photo_0001.jpg", "photo_0002.jpg", "notes.txt")
+	if got := readFile(t, filepath.Join(dir, "photo_0002.jpg")); got != "IMG_0002.jpg" {
+		t.Errorf("photo_0002.jpg: expected content IMG_0002.jpg, got %q", got)
+	}
+
+	// The batch is recorded like any other operation and can be undone.
+	if err := Undo(db, dir, 1, false); err != nil {
+		t.Fatalf("Undo failed: %v", err)
+	}
+	assertFiles(t, dir, "IMG_0001.jpg", "IMG_0002.jpg", "notes.txt")
+}
+
+func TestReplaceSkipsInvalidNames(t *testing.T) {
+	dir := t.TempDir()
+	createFiles(t, dir, "a-b.txt", "keep.txt")
+
+	plan, err := PlanReplace(dir, regexp.MustCompile(`-`), "/", ConflictSuffix)
+	if err != nil {
+		t.Fatalf("PlanReplace failed: %v", err)
+	}
+	if len(plan.Entries) != 1 || !plan.Entries[0].Skipped {
+		t.Fatalf("expected a single skipped entry, got %+v", plan.Entries)
+	}
+
+	plan, err = PlanReplace(dir, regexp.MustCompile(`.*`), "", ConflictSuffix)
+	if err != nil {
+		t.Fatalf("PlanReplace failed: %v", err)
+	}
+	if len(plan.Renames()) != 0 {
+		t.Errorf("expected empty names to be skipped, got %+v", plan.Renames())
+	}
+	if _, err := os.Stat(filepath.Join(dir, "a-b.txt")); err != nil {
+		t.Errorf("planning must not rename files: %v", err)
+	}
+}
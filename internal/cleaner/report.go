@@ -0,0 +1,92 @@
+package cleaner
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Results of a single entry of an undo or redo
+const (
+	ResultSucceeded      = "succeeded"       // moved back (undo) or again (redo)
+	ResultSkippedMissing = "skipped-missing" // the file is no longer where it was left
+	ResultFailed         = "failed"          // the rename failed and the batch was rolled back
+	ResultConflicted     = "conflicted"      // the target is taken or the file was replaced
+)
+
+// reasonMissing is the skip reason of entries whose file has disappeared
+const reasonMissing = "file no longer exists"
+
+// EntryResult is the outcome of undoing or redoing one rename
+type EntryResult struct {
+	BatchID string
+	Source  string
+	Target  string
+	Result  string
+	Reason  string
+}
+
+// ReplayReport collects the entry results of an undo or redo run
+type ReplayReport struct {
+	Operation string
+	Entries   []EntryResult
+}
+
+// Count returns the number of entries with the given result
+func (r *ReplayReport) Count(result string) int {
+	n := 0
+	for _, e := range r.Entries {
+		if e.Result == result {
+			n++
+		}
+	}
+	return n
+}
+
+// Incomplete returns the number of entries that were not restored
+func (r *ReplayReport) Incomplete() int {
+	return len(r.Entries) - r.Count(ResultSucceeded)
+}
+
+// Print writes the entries that were not restored and a one-line summary
+func (r *ReplayReport) Print() {
+	for _, e := range r.Entries {
+		if e.Result != ResultSucceeded {
+			fmt.Fprintf(os.Stdout, "[%s] %s → %s (%s)\n", strings.ToUpper(e.Result), displayPath(e.Source), displayPath(e.Target), e.Reason)
+		}
+	}
+	fmt.Fprintf(os.Stdout, "%s summary: %d succeeded, %d skipped-missing, %d failed, %d conflicted\n",
+		r.Operation, r.Count(ResultSucceeded), r.Count(ResultSkippedMissing), r.Count(ResultFailed), r.Count(ResultConflicted))
+}
+
+// finish prints the report and turns it into the error returned to the
+// caller: an *IncompleteError (wrapping err) if any entry was not restored,
+// otherwise err.
+func (r *ReplayReport) finish(err error, dryRun bool) error {
+	if dryRun || len(r.Entries) == 0 {
+		return err
+	}
+	r.Print()
+	if r.Incomplete() > 0 {
+		return &IncompleteError{Report: r, Err: err}
+	}
+	return err
+}
+
+// IncompleteError is returned by undo and redo when some files could not be
+// restored. Their entries keep their state, so running the command again
+// retries just those.
+type IncompleteError struct {
+	Report *ReplayReport
+	Err    error // the failure that rolled back a batch, if any
+}
+
+func (e *IncompleteError) Error() string {
+	msg := fmt.Sprintf("%d of %d file(s) could not be processed by %s", e.Report.Incomplete(), len(e.Report.Entries), e.Report.Operation)
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e *IncompleteError) Unwrap() error { return e.Err }
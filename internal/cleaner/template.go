@@ -0,0 +1,171 @@
+package cleaner
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// defaultDateLayout is used by {date}, {mtime} and {ctime} without a layout
+const defaultDateLayout = "2006-01-02"
+
+// placeholders are the names a rename template understands
+var placeholders = []string{"name", "ext", "parent", "counter", "date", "mtime", "ctime", "size", "hash"}
+
+// Template is a parsed rename template such as
+// "{date:2006-01-02}_{name}_{counter:3}{ext}". Literal braces are written
+// as {{ and }}.
+type Template struct {
+	source string
+	parts  []templatePart
+}
+
+// templatePart is a literal (placeholder empty) or a placeholder with its
+// optional argument
+type templatePart struct {
+	literal     string
+	placeholder string
+	arg         string
+}
+
+// ParseTemplate checks a rename template and prepares it for Expand
+func ParseTemplate(s string) (*Template, error) {
+	t := &Template{source: s}
+	var literal strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch {
+		case strings.HasPrefix(s[i:], "{{"), strings.HasPrefix(s[i:], "}}"):
+			literal.WriteByte(s[i])
+			i++
+		case s[i] == '}':
+			return nil, fmt.Errorf("unexpected } at position %d (write }} for a literal brace)", i+1)
+		case s[i] == '{':
+			end := strings.IndexByte(s[i:], '}')
+			if end < 0 {
+				return nil, fmt.Errorf("unclosed { at position %d", i+1)
+			}
+			part, err := parsePlaceholder(s[i+1 : i+end])
+			if err != nil {
+				return nil, err
+			}
+			if literal.Len() > 0 {
+				t.parts = append(t.parts, templatePart{literal: literal.String()})
+				literal.Reset()
+			}
+			t.parts = append(t.parts, part)
+			i += end
+		default:
+			literal.WriteByte(s[i])
+		}
+	}
+	if literal.Len() > 0 {
+		t.parts = append(t.parts, templatePart{literal: literal.String()})
+	}
+	return t, nil
+}
+
+func parsePlaceholder(body string) (templatePart, error) {
+	name, arg, hasArg := strings.Cut(body, ":")
+	part := templatePart{placeholder: name, arg: arg}
+	switch name {
+	case "name", "ext", "parent", "size":
+		if hasArg {
+			return part, fmt.Errorf("{%s} takes no argument", name)
+		}
+	case "counter", "hash":
+		if hasArg {
+			if n, err := strconv.Atoi(arg); err != nil || n < 1 {
+				return part, fmt.Errorf("{%s:%s}: the argument must be a positive number", name, arg)
+			}
+		}
+	case "date", "mtime", "ctime":
+		if hasArg && arg == "" {
+			return part, fmt.Errorf("{%s:}: the layout must not be empty", name)
+		}
+	default:
+		return part, fmt.Errorf("unknown placeholder {%s} (available: %s)", name, strings.Join(placeholders, ", "))
+	}
+	return part, nil
+}
+
+// String returns the template as written
+func (t *Template) String() string {
+	return t.source
+}
+
+// Expand fills in the template for the file at path, the counter-th file of
+// the walk
+func (t *Template) Expand(path string, info os.FileInfo, counter int) (string, error) {
+	var b strings.Builder
+	for _, part := range t.parts {
+		if part.placeholder == "" {
+			b.WriteString(part.literal)
+			continue
+		}
+		value, err := part.expand(path, info, counter)
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(value)
+	}
+	return b.String(), nil
+}
+
+func (p templatePart) expand(path string, info os.FileInfo, counter int) (string, error) {
+	ext := filepath.Ext(info.Name())
+	switch p.placeholder {
+	case "name":
+		return strings.TrimSuffix(info.Name(), ext), nil
+	case "ext":
+		return ext, nil
+	case "parent":
+		return filepath.Base(filepath.Dir(path)), nil
+	case "counter":
+		digits, _ := strconv.Atoi(p.arg)
+		return fmt.Sprintf("%0*d", digits, counter), nil
+	case "date", "mtime":
+		return info.ModTime().Format(p.layout()), nil
+	case "ctime":
+		return creationTime(info).Format(p.layout()), nil
+	case "size":
+		return strconv.FormatInt(info.Size(), 10), nil
+	case "hash":
+		length := 8
+		if p.arg != "" {
+			length, _ = strconv.Atoi(p.arg)
+		}
+		hash, err := contentHash(path)
+		if err != nil {
+			return "", err
+		}
+		return hash[:min(length, len(hash))], nil
+	}
+	return "", fmt.Errorf("unknown placeholder {%s}", p.placeholder)
+}
+
+func (p templatePart) layout() string {
+	if p.arg == "" {
+		return defaultDateLayout
+	}
+	return p.arg
+}
+
+// contentHash returns the hex SHA-256 of the whole file
+func contentHash(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,90 @@
+package cleaner
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTemplateExpand(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "trip")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	createFiles(t, dir, "beach.jpg")
+	path := filepath.Join(dir, "beach.jpg")
+	mtime := time.Date(2024, 7, 1, 9, 30, 0, 0, time.Local)
+	if err := os.Chtimes(path, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		template string
+		expected string
+	}{
+		{"{date:2006-01-02}_{name}_{counter:3}{ext}", "2024-07-01_beach_007.jpg"},
+		{"{parent}-{counter}{ext}", "trip-7.jpg"},
+		{"{mtime:20060102_1504}{ext}", "20240701_0930.jpg"},
+		{"{name}_{size}b{ext}", "beach_9b.jpg"},
+		{"{hash}{ext}", "83281d59.jpg"},
+		{"{{{name}}}{ext}", "{beach}.jpg"},
+	}
+	for _, test := range tests {
+		tmpl, err := ParseTemplate(test.template)
+		if err != nil {
+			t.Errorf("%s: ParseTemplate failed: %v", test.template, err)
+			continue
+		}
+		got, err := tmpl.Expand(path, info, 7)
+		if err != nil {
+			t.Errorf("%s: Expand failed: %v", test.template, err)
+		} else if got != test.expected {
+			t.Errorf("%s: expected %s, got %s", test.template, test.expected, got)
+		}
+	}
+}
+
+func TestParseTemplateErrors(t *testing.T) {
+	tests := map[string]string{
+		"{name":         "unclosed",
+		"name}":         "unexpected }",
+		"{title}":       "unknown placeholder",
+		"{counter:abc}": "positive number",
+		"{ext:upper}":   "takes no argument",
+	}
+	for template, message := range tests {
+		if _, err := ParseTemplate(template); err == nil || !strings.Contains(err.Error(), message) {
+			t.Errorf("%s: expected an error containing %q, got %v", template, message, err)
+		}
+	}
+}
+
+func TestRenameFilesUndo(t *testing.T) {
+	db := setupTestDB(t)
+	dir := t.TempDir()
+	createFiles(t, dir, "b.txt", "a.txt")
+
+	tmpl, err := ParseTemplate("doc_{counter:2}{ext}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := RenameFiles(db, dir, tmpl, ConflictAbort, false, ""); err != nil {
+		t.Fatalf("RenameFiles failed: %v", err)
+	}
+	// Files are numbered in walk (lexical) order.
+	if got := readFile(t, filepath.Join(dir, "doc_01.txt")); got != "a.txt" {
+		t.Errorf("doc_01.txt: expected content a.txt, got %q", got)
+	}
+	assertFiles(t, dir, "doc_02.txt")
+
+	if err := Undo(db, dir, 1, false); err != nil {
+		t.Fatalf("Undo failed: %v", err)
+	}
+	assertFiles(t, dir, "a.txt", "b.txt")
+}
@@ -1,85 +1,302 @@
 package cleaner
 
 import (
-	"nametidy/internal/utils"
-	"errors"
 	"fmt"
+	"os"
+	"strings"
+
+	"nametidy/internal/utils"
 
 	"gorm.io/gorm"
 )
 
-func Undo(db *gorm.DB, dirPath string, dryRun bool) error {
-	var lastBatch RenameHistory
-	// 最新の未返却操作を取得
-	if err := db.Where("reverted = ? AND redone = ?", false, false).
-		Order("created_at desc").First(&lastBatch).Error; err != nil {
-		return errors.New("no operation to undo")
+// Undo reverts the last count batches under dirPath, newest first
+func Undo(db *gorm.DB, dirPath string, count int, dryRun bool) error {
+	root, err := absPath(dirPath)
+	if err != nil {
+		return err
 	}
+	// 新しい順に未返却の操作を取得
+	batchIDs, err := GetUndoableBatches(db, root, count)
+	if err != nil {
+		return err
+	}
+	if len(batchIDs) == 0 {
+		return fmt.Errorf("%w: no operation to undo under %s", ErrNothingToDo, dirPath)
+	}
+	return replayBatches(db, "undo", root, batchIDs, count, dryRun)
+}
 
-	// 同じバッチIDを持つ履歴をすべて取得
-	var histories []RenameHistory
-	if err := db.Where("batch_id = ?", lastBatch.BatchID).Find(&histories).Error; err != nil {
+// Redo re-applies the last count undone batches under dirPath, most recently
+// undone first
+func Redo(db *gorm.DB, dirPath string, count int, dryRun bool) error {
+	root, err := absPath(dirPath)
+	if err != nil {
+		return err
+	}
+	// 最近戻された順に操作を取得
+	batchIDs, err := GetRedoableBatches(db, root, count)
+	if err != nil {
 		return err
 	}
+	if len(batchIDs) == 0 {
+		return fmt.Errorf("%w: no operation to redo under %s", ErrNothingToDo, dirPath)
+	}
+	return replayBatches(db, "redo", root, batchIDs, count, dryRun)
+}
 
-	// それぞれの履歴をやり直す
-	for _, h := range histories {
-		if utils.FileExists(h.NewPath) {
-			if dryRun {
-				fmt.Printf("[DRY-RUN] %s → %s\n", h.NewPath, h.OriginalPath)
-			} else {
-				if err := utils.RenameFile(h.NewPath, h.OriginalPath, false); err != nil {
-					utils.Warn(fmt.Sprintf("Undo failed: %s → %s", h.NewPath, h.OriginalPath))
-				}
+// UndoBatch reverts one specific batch, even if newer batches exist. It
+// refuses when files of the batch have moved or when a newer batch touched
+// the same paths, unless force is set.
+func UndoBatch(db *gorm.DB, dirPath, batchID string, force, dryRun bool) error {
+	return replaySingleBatch(db, "undo", dirPath, batchID, force, dryRun)
+}
+
+// RedoBatch re-applies one specific undone batch with the same checks as
+// UndoBatch.
+func RedoBatch(db *gorm.DB, dirPath, batchID string, force, dryRun bool) error {
+	return replaySingleBatch(db, "redo", dirPath, batchID, force, dryRun)
+}
+
+func replaySingleBatch(db *gorm.DB, operation, dirPath, batchID string, force, dryRun bool) error {
+	root, err := absPath(dirPath)
+	if err != nil {
+		return err
+	}
+	batch, err := GetBatch(db, batchID)
+	if err != nil {
+		return err
+	}
+	if !batchWithin(root, batch) {
+		return fmt.Errorf("batch %s touched files outside %s", batchID, dirPath)
+	}
+
+	reverse := operation == "undo"
+	if reverse && !hasStatus(batch.Status, undoableStatuses) {
+		return fmt.Errorf("batch %s cannot be undone (status %s)", batchID, batch.Status)
+	}
+	if !reverse && !hasStatus(batch.Status, redoableStatuses) {
+		return fmt.Errorf("batch %s has not been undone (status %s)", batchID, batch.Status)
+	}
+
+	var problems []string
+	var paths []string
+	for _, h := range pendingEntries(batch.Entries, reverse) {
+		from := h.NewPath
+		if !reverse {
+			from = h.OriginalPath
+		}
+		if !utils.FileExists(from) {
+			problems = append(problems, "missing "+from)
+		} else if mismatch, err := h.Verify(from); err != nil || mismatch != "" {
+			if err != nil {
+				mismatch = err.Error()
 			}
+			problems = append(problems, fmt.Sprintf("%s: %s", from, mismatch))
 		}
+		paths = append(paths, h.OriginalPath, h.NewPath)
 	}
 
-	// 履歴をrevertedとしてマーク
-	if !dryRun {
-		db.Model(&RenameHistory{}).
-			Where("batch_id = ?", lastBatch.BatchID).
-			Update("reverted", true).
-			Update("operation_type", "undo") // "undo"としてマーク
+	later, err := laterBatchesTouching(db, batch, paths)
+	if err != nil {
+		return err
+	}
+	for _, id := range later {
+		problems = append(problems, "touched by later batch "+id)
 	}
 
-	return nil
+	if len(problems) > 0 {
+		if !force {
+			return fmt.Errorf("refusing to %s batch %s (use --force to override): %s",
+				operation, batchID, strings.Join(problems, "; "))
+		}
+		for _, p := range problems {
+			utils.Warn(p)
+		}
+	}
+
+	report := &ReplayReport{Operation: operation}
+	err = replayBatch(db, report, root, batch, nil, force, dryRun)
+	return report.finish(err, dryRun)
+}
+
+// laterBatchesTouching returns the batches created after first that still
+// have renamed files and whose renames involve any of paths
+func laterBatchesTouching(db *gorm.DB, first *Batch, paths []string) ([]string, error) {
+	var ids []string
+	err := db.Model(&RenameHistory{}).
+		Joins("JOIN batches ON batches.id = rename_histories.batch_id").
+		Where("batches.id <> ? AND batches.created_at > ? AND batches.status IN ?", first.ID, first.CreatedAt, undoableStatuses).
+		Where("rename_histories.original_path IN ? OR rename_histories.new_path IN ?", paths, paths).
+		Distinct("rename_histories.batch_id").
+		Pluck("rename_histories.batch_id", &ids).Error
+	return ids, err
 }
 
-func Redo(db *gorm.DB, dirPath string, dryRun bool) error {
-	var lastUndone RenameHistory
-	// 最新の戻された操作を取得
-	if err := db.Where("reverted = ? AND redone = ?", true, false).
-		Order("created_at desc").First(&lastUndone).Error; err != nil {
-		return errors.New("no operation to redo")
+// hasStatus reports whether status is one of statuses
+func hasStatus(status string, statuses []string) bool {
+	for _, s := range statuses {
+		if s == status {
+			return true
+		}
 	}
+	return false
+}
 
-	// 同じバッチIDを持つ履歴をすべて取得
-	var histories []RenameHistory
-	if err := db.Where("batch_id = ?", lastUndone.BatchID).Find(&histories).Error; err != nil {
-		return err
+// pendingEntries returns the entries that undo (reverse) or redo still has to
+// move. Entries already moved by an earlier, partial run are left out.
+func pendingEntries(entries []RenameHistory, reverse bool) []RenameHistory {
+	state := StatusUndone
+	if reverse {
+		state = StatusApplied
+	}
+	var pending []RenameHistory
+	for _, h := range entries {
+		if h.State == state {
+			pending = append(pending, h)
+		}
+	}
+	return pending
+}
+
+// replayBatches undoes or redoes the given batches one by one, each as its own
+// transactional batch, and stops at the first one that could not be replayed
+// completely. In dry-run mode nothing moves, so each batch is planned on top
+// of the moves planned for the batches before it.
+func replayBatches(db *gorm.DB, operation, dirPath string, batchIDs []string, count int, dryRun bool) error {
+	if len(batchIDs) < count {
+		utils.Warn(fmt.Sprintf("Only %d operation(s) to %s", len(batchIDs), operation))
+	}
+	report := &ReplayReport{Operation: operation}
+	var moves dryRunMoves
+	if dryRun {
+		moves = dryRunMoves{}
+	}
+	for _, batchID := range batchIDs {
+		utils.Info(fmt.Sprintf("%s %s", operation, batchID))
+		batch, err := GetBatch(db, batchID)
+		if err != nil {
+			return err
+		}
+		before := report.Incomplete()
+		if err := replayBatch(db, report, dirPath, batch, moves, false, dryRun); err != nil {
+			return report.finish(fmt.Errorf("%s of %s failed: %w", operation, batchID, err), dryRun)
+		}
+		if !dryRun && report.Incomplete() > before {
+			break
+		}
 	}
+	return report.finish(nil, dryRun)
+}
 
-	// それぞれの履歴を元に戻す
-	for _, h := range histories {
-		if utils.FileExists(h.OriginalPath) {
-			if dryRun {
-				fmt.Printf("[DRY-RUN] %s → %s\n", h.OriginalPath, h.NewPath)
-			} else {
-				if err := utils.RenameFile(h.OriginalPath, h.NewPath, false); err != nil {
-					utils.Warn(fmt.Sprintf("Redo failed: %s → %s", h.OriginalPath, h.NewPath))
+// replayBatch plans and applies the undo or redo of one batch and adds the
+// result of every entry to report. In dry-run mode the plan is only printed
+// and its moves are added to moves, unless that is nil.
+func replayBatch(db *gorm.DB, report *ReplayReport, dirPath string, batch *Batch, moves dryRunMoves, force, dryRun bool) error {
+	plan, results := planBatch(report.Operation, dirPath, batch, moves, force)
+	if dryRun {
+		plan.Print(os.Stdout)
+		moves.add(plan)
+		return nil
+	}
+
+	err := plan.Commit(db)
+	for i := range results {
+		if results[i].Result != "" {
+			continue
+		}
+		if err != nil {
+			results[i].Result = ResultFailed
+			results[i].Reason = err.Error()
+		} else {
+			results[i].Result = ResultSucceeded
+		}
+	}
+	report.Entries = append(report.Entries, results...)
+	return err
+}
+
+// planBatch builds the plan that moves the pending files of a recorded batch
+// back to their original paths (undo) or onto their new paths again (redo).
+// Files that are missing or taken are skipped, as are files that no longer
+// match their recorded fingerprint unless force is set. Paths are looked up
+// through moves, which may be nil. The results of the skipped entries are
+// filled in; the others are left for the caller.
+func planBatch(operation, dirPath string, batch *Batch, moves dryRunMoves, force bool) (*Plan, []EntryResult) {
+	reverse := operation == "undo"
+	plan := NewPlan(operation, dirPath)
+	plan.Reverts = batch.ID
+	plan.moves = moves
+
+	pending := pendingEntries(batch.Entries, reverse)
+	results := make([]EntryResult, len(pending))
+	for i, h := range pending {
+		from, to := h.OriginalPath, h.NewPath
+		if reverse {
+			from, to = to, from
+		}
+		results[i] = EntryResult{BatchID: batch.ID, Source: from, Target: to}
+
+		current := moves.locate(from)
+		if current == "" || !utils.FileExists(current) {
+			plan.Skip(from, to, reasonMissing)
+			continue
+		}
+		if !force {
+			if mismatch, err := h.Verify(current); err != nil || mismatch != "" {
+				if err != nil {
+					mismatch = err.Error()
 				}
+				plan.Skip(from, to, "file changed since it was renamed: "+mismatch)
+				continue
 			}
 		}
+		plan.Entries = append(plan.Entries, PlanEntry{Source: from, Target: to, Reason: operation + " " + batch.ID})
 	}
+	// Skipping only marks entries, so Resolve cannot fail here.
+	plan.Resolve(ConflictSkip)
 
-	// 履歴をredoneとしてマーク
-	if !dryRun {
-		db.Model(&RenameHistory{}).
-			Where("batch_id = ?", lastUndone.BatchID).
-			Update("reverted", false).
-			Update("operation_type", "redo") // "redo"としてマーク
+	for i, e := range plan.Entries {
+		if !e.Skipped {
+			continue
+		}
+		results[i].Result = ResultConflicted
+		if len(e.Conflicts) > 0 && e.Conflicts[0] == reasonMissing {
+			results[i].Result = ResultSkippedMissing
+		}
+		results[i].Reason = e.conflict()
 	}
+	return plan, results
+}
 
-	return nil
+// dryRunMoves tracks the renames planned by earlier batches of a dry run. It
+// maps each path a file would be moved to onto the path it still has on disk,
+// and each path a file would be moved away from onto "".
+type dryRunMoves map[string]string
+
+// locate returns the path on disk of the file that would be at path, or ""
+// when path would be empty
+func (m dryRunMoves) locate(path string) string {
+	if current, ok := m[path]; ok {
+		return current
+	}
+	return path
+}
+
+// add records the renames of plan
+func (m dryRunMoves) add(plan *Plan) {
+	if m == nil {
+		return
+	}
+	renames := plan.Renames()
+	current := make([]string, len(renames))
+	for i, e := range renames {
+		current[i] = m.locate(e.Source)
+	}
+	for _, e := range renames {
+		m[e.Source] = ""
+	}
+	for i, e := range renames {
+		m[e.Target] = current[i]
+	}
 }
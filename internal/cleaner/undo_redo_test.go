@@ -0,0 +1,215 @@
+package cleaner
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func assertFiles(t *testing.T, dir string, names ...string) {
+	t.Helper()
+	for _, name := range names {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("expected %s to exist: %v", name, err)
+		}
+	}
+}
+
+func TestUndoRedoStack(t *testing.T) {
+	db := setupTestDB(t)
+	dir := t.TempDir()
+	createFiles(t, dir, "a b.txt")
+
+	if err := Clean(db, dir, nil, ConflictSuffix, false, ""); err != nil {
+		t.Fatalf("Clean failed: %v", err)
+	}
+	if err := NumberFiles(db, dir, 2, false, ConflictSuffix, false, ""); err != nil {
+		t.Fatalf("NumberFiles failed: %v", err)
+	}
+	assertFiles(t, dir, "01_a_b.txt")
+
+	// Undo both batches, newest first.
+	if err := Undo(db, dir, 2, false); err != nil {
+		t.Fatalf("Undo failed: %v", err)
+	}
+	assertFiles(t, dir, "a b.txt")
+	if err := Undo(db, dir, 1, false); err == nil {
+		t.Error("expected nothing left to undo")
+	}
+
+	// Redo walks forward again, starting with the clean batch.
+	if err := Redo(db, dir, 1, false); err != nil {
+		t.Fatalf("Redo failed: %v", err)
+	}
+	assertFiles(t, dir, "a_b.txt")
+
+	ids, err := GetUndoableBatches(db, "", 10)
+	if err != nil || len(ids) != 1 || ids[0][:5] != "clean" {
+		t.Fatalf("expected the clean batch to be undoable again, got %v (%v)", ids, err)
+	}
+
+	// A new operation discards the remaining redo branch.
+	if err := NumberFiles(db, dir, 3, false, ConflictSuffix, false, ""); err != nil {
+		t.Fatalf("NumberFiles failed: %v", err)
+	}
+	if ids, _ := GetRedoableBatches(db, "", 10); len(ids) != 0 {
+		t.Errorf("expected the redo branch to be discarded, got %v", ids)
+	}
+	if err := Redo(db, dir, 1, false); err == nil {
+		t.Error("expected nothing left to redo")
+	}
+}
+
+func TestDryRunUndoFollowsEarlierBatches(t *testing.T) {
+	db := setupTestDB(t)
+	dir := t.TempDir()
+	createFiles(t, dir, "a b.txt")
+	if err := Clean(db, dir, nil, ConflictSuffix, false, ""); err != nil {
+		t.Fatalf("Clean failed: %v", err)
+	}
+	if err := NumberFiles(db, dir, 1, false, ConflictSuffix, false, ""); err != nil {
+		t.Fatalf("NumberFiles failed: %v", err)
+	}
+
+	// The clean batch renamed a_b.txt, which only exists once the number
+	// batch has been undone, so it is planned on top of that undo.
+	ids, err := GetUndoableBatches(db, dir, 2)
+	if err != nil || len(ids) != 2 {
+		t.Fatalf("expected two undoable batches, got %v (%v)", ids, err)
+	}
+	moves := dryRunMoves{}
+	for _, id := range ids {
+		batch, err := GetBatch(db, id)
+		if err != nil {
+			t.Fatalf("GetBatch failed: %v", err)
+		}
+		plan, _ := planBatch("undo", dir, batch, moves, false)
+		if len(plan.Renames()) != 1 {
+			t.Fatalf("expected the undo of %s to be planned, got %+v", id, plan.Entries)
+		}
+		moves.add(plan)
+	}
+	if got := moves.locate(filepath.Join(dir, "a b.txt")); got != filepath.Join(dir, "1_a_b.txt") {
+		t.Errorf("expected a b.txt to come from 1_a_b.txt, got %q", got)
+	}
+
+	if err := Undo(db, dir, 2, true); err != nil {
+		t.Fatalf("dry-run Undo failed: %v", err)
+	}
+	assertFiles(t, dir, "1_a_b.txt")
+}
+
+func TestUndoBatchByID(t *testing.T) {
+	db := setupTestDB(t)
+	dir := t.TempDir()
+	createFiles(t, dir, "a b.txt")
+	if err := Clean(db, dir, nil, ConflictSuffix, false, ""); err != nil {
+		t.Fatalf("Clean failed: %v", err)
+	}
+	first, _ := GetLastUndoableBatch(db)
+
+	createFiles(t, dir, "c d.txt")
+	if err := Clean(db, dir, nil, ConflictSuffix, false, ""); err != nil {
+		t.Fatalf("Clean failed: %v", err)
+	}
+	second, _ := GetLastUndoableBatch(db)
+
+	// The older batch can be undone on its own; the newer one stays applied.
+	if err := UndoBatch(db, dir, first, false, false); err != nil {
+		t.Fatalf("UndoBatch failed: %v", err)
+	}
+	assertFiles(t, dir, "a b.txt", "c_d.txt")
+	if err := UndoBatch(db, dir, first, false, false); err == nil {
+		t.Error("expected an error when undoing the same batch twice")
+	}
+	if err := RedoBatch(db, dir, first, false, false); err != nil {
+		t.Fatalf("RedoBatch failed: %v", err)
+	}
+	assertFiles(t, dir, "a_b.txt", "c_d.txt")
+
+	// A later batch renamed c_d.txt again, so the second batch is refused.
+	if err := NumberFiles(db, dir, 1, false, ConflictSuffix, false, ""); err != nil {
+		t.Fatalf("NumberFiles failed: %v", err)
+	}
+	if err := UndoBatch(db, dir, second, false, false); err == nil {
+		t.Error("expected UndoBatch to refuse a batch touched by a later one")
+	}
+	assertFiles(t, dir, "1_a_b.txt", "2_c_d.txt")
+}
+
+func TestUndoScopedToPath(t *testing.T) {
+	db := setupTestDB(t)
+	root := t.TempDir()
+	photos, docs := filepath.Join(root, "photos"), filepath.Join(root, "docs")
+	for _, dir := range []string{photos, docs} {
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatalf("failed to create %s: %v", dir, err)
+		}
+		createFiles(t, dir, "a b.txt")
+		if err := Clean(db, dir, nil, ConflictSuffix, false, ""); err != nil {
+			t.Fatalf("Clean failed: %v", err)
+		}
+	}
+
+	// docs was cleaned last, but undo in photos must only see the photos batch.
+	if err := Undo(db, photos, 1, false); err != nil {
+		t.Fatalf("Undo failed: %v", err)
+	}
+	assertFiles(t, photos, "a b.txt")
+	assertFiles(t, docs, "a_b.txt")
+
+	if err := Undo(db, photos, 1, false); err == nil {
+		t.Error("expected nothing left to undo under photos")
+	}
+
+	last, err := GetLastUndoableBatch(db)
+	if err != nil {
+		t.Fatalf("expected the docs batch to remain undoable: %v", err)
+	}
+	histories, _ := GetHistoriesByBatch(db, last)
+	for _, h := range histories {
+		if !filepath.IsAbs(h.OriginalPath) || !filepath.IsAbs(h.NewPath) {
+			t.Errorf("expected absolute paths in history, got %+v", h)
+		}
+	}
+}
+
+func TestUndoRetriesIncompleteEntries(t *testing.T) {
+	db := setupTestDB(t)
+	dir := t.TempDir()
+	createFiles(t, dir, "a b.txt", "c d.txt")
+	if err := Clean(db, dir, nil, ConflictSuffix, false, ""); err != nil {
+		t.Fatalf("Clean failed: %v", err)
+	}
+	batchID, _ := GetLastUndoableBatch(db)
+
+	// c_d.txt is moved away, so only a_b.txt can be restored.
+	aside := filepath.Join(t.TempDir(), "c_d.txt")
+	if err := os.Rename(filepath.Join(dir, "c_d.txt"), aside); err != nil {
+		t.Fatal(err)
+	}
+	var incomplete *IncompleteError
+	if err := Undo(db, dir, 1, false); !errors.As(err, &incomplete) {
+		t.Fatalf("expected an IncompleteError, got %v", err)
+	}
+	if incomplete.Report.Count(ResultSucceeded) != 1 || incomplete.Report.Count(ResultSkippedMissing) != 1 {
+		t.Errorf("unexpected results: %+v", incomplete.Report.Entries)
+	}
+	assertFiles(t, dir, "a b.txt")
+	if batch, _ := GetBatch(db, batchID); batch.Status != StatusPartial {
+		t.Errorf("expected a partial batch, got %s", batch.Status)
+	}
+
+	// Once the file is back, undo only retries the entry that failed.
+	if err := os.Rename(aside, filepath.Join(dir, "c_d.txt")); err != nil {
+		t.Fatal(err)
+	}
+	if err := Undo(db, dir, 1, false); err != nil {
+		t.Fatalf("Undo failed: %v", err)
+	}
+	assertFiles(t, dir, "a b.txt", "c d.txt")
+	if batch, _ := GetBatch(db, batchID); batch.Status != StatusUndone {
+		t.Errorf("expected the batch to be undone, got %s", batch.Status)
+	}
+}
@@ -0,0 +1,133 @@
+package rules
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+func init() {
+	Register("replace-chars", newReplaceChars)
+	Register("collapse-separators", newCollapseSeparators)
+	Register("trim", newTrim)
+	Register("case", newCase)
+	Register("strip-pattern", newStripPattern)
+	Register("max-length", newMaxLength)
+}
+
+// regexpRule replaces every match of a regular expression
+type regexpRule struct {
+	re   *regexp.Regexp
+	with string
+}
+
+func (r regexpRule) Apply(name string) string {
+	return r.re.ReplaceAllString(name, r.with)
+}
+
+func compile(opts *Options, key, def string) (*regexp.Regexp, error) {
+	pattern, err := opts.String(key, def)
+	if err != nil {
+		return nil, err
+	}
+	if pattern == "" {
+		return nil, fmt.Errorf("option %s must not be empty", key)
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %v", key, err)
+	}
+	return re, nil
+}
+
+// replace-chars replaces every character matched by pattern with the given
+// string. The default pattern matches all but ASCII letters, digits,
+// underscores and dots; with unicode it keeps letters and digits of any
+// script.
+func newReplaceChars(opts *Options) (Rule, error) {
+	unicode, err := opts.Bool("unicode", false)
+	if err != nil {
+		return nil, err
+	}
+	pattern := `[^\w\d.]`
+	if unicode {
+		pattern = unicodeUnwanted
+	}
+	re, err := compile(opts, "pattern", pattern)
+	if err != nil {
+		return nil, err
+	}
+	with, err := opts.String("with", "_")
+	if err != nil {
+		return nil, err
+	}
+	return regexpRule{re: re, with: with}, nil
+}
+
+// collapse-separators turns runs of separator characters into a single one.
+func newCollapseSeparators(opts *Options) (Rule, error) {
+	chars, err := opts.String("chars", "_")
+	if err != nil {
+		return nil, err
+	}
+	if chars == "" {
+		return nil, fmt.Errorf("option chars must not be empty")
+	}
+	first, _ := utf8.DecodeRuneInString(chars)
+	with, err := opts.String("with", string(first))
+	if err != nil {
+		return nil, err
+	}
+	re := regexp.MustCompile("[" + regexp.QuoteMeta(chars) + "]+")
+	return regexpRule{re: re, with: with}, nil
+}
+
+// trim removes separator characters from both ends.
+type trimRule struct {
+	chars string
+}
+
+func (r trimRule) Apply(name string) string {
+	return strings.Trim(name, r.chars)
+}
+
+func newTrim(opts *Options) (Rule, error) {
+	chars, err := opts.String("chars", "_")
+	if err != nil {
+		return nil, err
+	}
+	return trimRule{chars: chars}, nil
+}
+
+// strip-pattern removes every match of a regular expression.
+func newStripPattern(opts *Options) (Rule, error) {
+	re, err := compile(opts, "pattern", "")
+	if err != nil {
+		return nil, err
+	}
+	return regexpRule{re: re}, nil
+}
+
+// max-length cuts the name to at most length characters.
+type maxLengthRule struct {
+	length int
+}
+
+func (r maxLengthRule) Apply(name string) string {
+	if utf8.RuneCountInString(name) <= r.length {
+		return name
+	}
+	return string([]rune(name)[:r.length])
+}
+
+func newMaxLength(opts *Options) (Rule, error) {
+	length, err := opts.Int("length", 0)
+	if err != nil {
+		return nil, err
+	}
+	if length < 1 {
+		return nil, fmt.Errorf("option length must be at least 1")
+	}
+	return maxLengthRule{length: length}, nil
+}
@@ -0,0 +1,106 @@
+package rules
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// caseStyles lists the styles of the case rule. lower and upper convert the
+// name as a whole; the others split it into words and join them again.
+var caseStyles = []string{"lower", "upper", "title", "snake", "kebab", "camel", "pascal"}
+
+// CaseStyles returns the styles accepted by the case rule
+func CaseStyles() []string {
+	return append([]string(nil), caseStyles...)
+}
+
+// case changes the letter case of the name. Word styles split the name on
+// separators (anything but letters and digits) and on camelCase boundaries,
+// so "myFile-v2 draft" becomes my_file_v2_draft in snake case.
+type caseRule struct {
+	convert func(string) string
+}
+
+func (r caseRule) Apply(name string) string {
+	return r.convert(name)
+}
+
+func newCase(opts *Options) (Rule, error) {
+	style, err := opts.String("style", "lower")
+	if err != nil {
+		return nil, err
+	}
+	style = strings.ToLower(style)
+
+	defaultSep := ""
+	switch style {
+	case "lower":
+		return caseRule{convert: strings.ToLower}, nil
+	case "upper":
+		return caseRule{convert: strings.ToUpper}, nil
+	case "snake", "title":
+		defaultSep = "_"
+	case "kebab":
+		defaultSep = "-"
+	case "camel", "pascal":
+	default:
+		return nil, fmt.Errorf("unknown style %q (expected %s)", style, strings.Join(caseStyles, ", "))
+	}
+
+	sep, err := opts.String("separator", defaultSep)
+	if err != nil {
+		return nil, err
+	}
+	return caseRule{convert: func(name string) string {
+		words := splitWords(name)
+		if len(words) == 0 {
+			return name
+		}
+		for i, w := range words {
+			switch {
+			case style == "snake" || style == "kebab" || (style == "camel" && i == 0):
+				words[i] = strings.ToLower(w)
+			default:
+				words[i] = capitalize(w)
+			}
+		}
+		return strings.Join(words, sep)
+	}}, nil
+}
+
+// splitWords breaks name at separators and at case changes: fooBar, v2Draft
+// and the end of an acronym (HTMLFile → HTML, File).
+func splitWords(name string) []string {
+	var words []string
+	var word []rune
+	runes := []rune(name)
+	for i, r := range runes {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && !unicode.Is(unicode.Mn, r) {
+			if len(word) > 0 {
+				words = append(words, string(word))
+				word = nil
+			}
+			continue
+		}
+		if len(word) > 0 && unicode.IsUpper(r) {
+			prev := word[len(word)-1]
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && nextLower) {
+				words = append(words, string(word))
+				word = nil
+			}
+		}
+		word = append(word, r)
+	}
+	if len(word) > 0 {
+		words = append(words, string(word))
+	}
+	return words
+}
+
+func capitalize(word string) string {
+	r, size := utf8.DecodeRuneInString(word)
+	return string(unicode.ToTitle(r)) + strings.ToLower(word[size:])
+}
@@ -0,0 +1,306 @@
+// Package rules implements the configurable pipeline that turns a file name
+// into its cleaned form. A profile is an ordered list of named rules, each
+// applied to the base name (the extension is kept as-is).
+package rules
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultProfile is the name of the profile used when none is selected
+const DefaultProfile = "default"
+
+// Rule transforms the base name of a file
+type Rule interface {
+	Apply(name string) string
+}
+
+// Factory builds a rule from its options
+type Factory func(opts *Options) (Rule, error)
+
+var registry = make(map[string]Factory)
+
+// Register makes a rule available to profiles under name
+func Register(name string, factory Factory) {
+	registry[name] = factory
+}
+
+// Names returns the registered rule names in alphabetical order
+func Names() []string {
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Spec is one step of a profile as written in the config file:
+//
+//	profiles:
+//	  dashes:
+//	    - rule: replace-chars
+//	      with: "-"
+//
+// A step with "target: extension" is applied to the extension (without the
+// dot) instead of the base name.
+type Spec map[string]interface{}
+
+// Pipeline is a built profile
+type Pipeline struct {
+	Name  string
+	rules []Rule
+	ext   []Rule
+}
+
+// Clean applies every rule in order to the base name of fileName and returns
+// the result with the extension, which only the extension rules touch
+func (p *Pipeline) Clean(fileName string) string {
+	ext := filepath.Ext(fileName)
+	name := fileName[:len(fileName)-len(ext)]
+	for _, r := range p.rules {
+		name = r.Apply(name)
+	}
+	if ext != "" && len(p.ext) > 0 {
+		e := ext[1:]
+		for _, r := range p.ext {
+			e = r.Apply(e)
+		}
+		ext = "." + e
+	}
+	return name + ext
+}
+
+// New builds a pipeline from its specs
+func New(name string, specs []Spec) (*Pipeline, error) {
+	p := &Pipeline{Name: name}
+	for i, spec := range specs {
+		ruleName, _ := spec["rule"].(string)
+		factory, ok := registry[ruleName]
+		if !ok {
+			return nil, fmt.Errorf("profile %s, step %d: unknown rule %q (available: %s)", name, i+1, ruleName, strings.Join(Names(), ", "))
+		}
+
+		opts := &Options{values: spec, used: map[string]bool{"rule": true}}
+		target, err := opts.String("target", "name")
+		if err == nil && target != "name" && target != "extension" {
+			err = fmt.Errorf("unknown target %q (expected name or extension)", target)
+		}
+		var rule Rule
+		if err == nil {
+			rule, err = factory(opts)
+		}
+		if err == nil {
+			err = opts.checkUnused()
+		}
+		if err != nil {
+			return nil, fmt.Errorf("profile %s, step %d (%s): %v", name, i+1, ruleName, err)
+		}
+		if target == "extension" {
+			p.ext = append(p.ext, rule)
+		} else {
+			p.rules = append(p.rules, rule)
+		}
+	}
+	return p, nil
+}
+
+// Prepend returns a copy of the pipeline that first applies the rules built
+// from specs, e.g. a transliterate step requested on the command line
+func (p *Pipeline) Prepend(specs ...Spec) (*Pipeline, error) {
+	pre, err := New(p.Name, specs)
+	if err != nil {
+		return nil, err
+	}
+	return &Pipeline{
+		Name:  extendedName(p.Name, specs),
+		rules: slices.Concat(pre.rules, p.rules),
+		ext:   slices.Concat(pre.ext, p.ext),
+	}, nil
+}
+
+// Append returns a copy of the pipeline that applies the rules built from
+// specs after its own, e.g. a case conversion requested on the command line
+func (p *Pipeline) Append(specs ...Spec) (*Pipeline, error) {
+	post, err := New(p.Name, specs)
+	if err != nil {
+		return nil, err
+	}
+	return &Pipeline{
+		Name:  extendedName(p.Name, specs),
+		rules: slices.Concat(p.rules, post.rules),
+		ext:   slices.Concat(p.ext, post.ext),
+	}, nil
+}
+
+func extendedName(name string, specs []Spec) string {
+	for _, spec := range specs {
+		name += "+" + fmt.Sprint(spec["rule"])
+	}
+	return name
+}
+
+// Parse builds a pipeline from a profile read from the config file, which is
+// a list of maps. A nil profile falls back to the built-in profile of the
+// same name.
+func Parse(name string, raw interface{}) (*Pipeline, error) {
+	if raw == nil {
+		if name == DefaultProfile {
+			return Default(), nil
+		}
+		if specs, ok := builtinProfiles[name]; ok {
+			return New(name, specs)
+		}
+		return nil, fmt.Errorf("profile %s is not defined", name)
+	}
+
+	list, ok := raw.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("profile %s must be a list of rules", name)
+	}
+	specs := make([]Spec, len(list))
+	for i, item := range list {
+		spec, ok := toSpec(item)
+		if !ok {
+			return nil, fmt.Errorf("profile %s, step %d: expected a map with a rule key", name, i+1)
+		}
+		specs[i] = spec
+	}
+	return New(name, specs)
+}
+
+func toSpec(item interface{}) (Spec, bool) {
+	switch m := item.(type) {
+	case map[string]interface{}:
+		return Spec(m), true
+	case map[interface{}]interface{}:
+		spec := make(Spec, len(m))
+		for k, v := range m {
+			spec[fmt.Sprint(k)] = v
+		}
+		return spec, true
+	}
+	return nil, false
+}
+
+// UnicodeProfile is the name of the built-in profile that keeps non-ASCII
+// letters
+const UnicodeProfile = "unicode"
+
+// DefaultSpecs is the built-in default profile: the behavior nametidy always
+// had.
+var DefaultSpecs = []Spec{
+	{"rule": "replace-chars"},
+	{"rule": "collapse-separators"},
+	{"rule": "trim"},
+}
+
+// builtinProfiles are available without any config. DefaultSpecs is listed
+// separately because Default() caches it.
+var builtinProfiles = map[string][]Spec{
+	UnicodeProfile: {
+		{"rule": "normalize", "form": "nfc"},
+		{"rule": "fold-width"},
+		{"rule": "replace-chars", "unicode": true},
+		{"rule": "collapse-separators"},
+		{"rule": "trim"},
+	},
+}
+
+// Default returns the built-in default profile
+func Default() *Pipeline {
+	return defaultPipeline()
+}
+
+// defaultPipeline is built on first use, after the rules have been registered
+var defaultPipeline = sync.OnceValue(func() *Pipeline {
+	p, err := New(DefaultProfile, DefaultSpecs)
+	if err != nil {
+		panic(err)
+	}
+	return p
+})
+
+// Options gives a rule factory typed access to the keys of its spec
+type Options struct {
+	values Spec
+	used   map[string]bool
+}
+
+// String returns the option key, or def when it is not set
+func (o *Options) String(key, def string) (string, error) {
+	o.used[key] = true
+	v, ok := o.values[key]
+	if !ok || v == nil {
+		return def, nil
+	}
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case int, int64, float64, bool:
+		return fmt.Sprint(v), nil
+	}
+	return "", fmt.Errorf("option %s must be a string", key)
+}
+
+// Int returns the option key, or def when it is not set
+func (o *Options) Int(key string, def int) (int, error) {
+	o.used[key] = true
+	v, ok := o.values[key]
+	if !ok || v == nil {
+		return def, nil
+	}
+	switch v := v.(type) {
+	case int:
+		return v, nil
+	case int64:
+		return int(v), nil
+	case float64:
+		if v == float64(int(v)) {
+			return int(v), nil
+		}
+	case string:
+		if n, err := strconv.Atoi(v); err == nil {
+			return n, nil
+		}
+	}
+	return 0, fmt.Errorf("option %s must be a whole number", key)
+}
+
+// Bool returns the option key, or def when it is not set
+func (o *Options) Bool(key string, def bool) (bool, error) {
+	o.used[key] = true
+	v, ok := o.values[key]
+	if !ok || v == nil {
+		return def, nil
+	}
+	switch v := v.(type) {
+	case bool:
+		return v, nil
+	case string:
+		if b, err := strconv.ParseBool(v); err == nil {
+			return b, nil
+		}
+	}
+	return false, fmt.Errorf("option %s must be true or false", key)
+}
+
+func (o *Options) checkUnused() error {
+	var unknown []string
+	for key := range o.values {
+		if !o.used[key] {
+			unknown = append(unknown, key)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return fmt.Errorf("unknown option(s) %s", strings.Join(unknown, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,180 @@
+package rules
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDefaultProfile(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"My_File___.txt", "My_File.txt"},
+		{"Special$$File!.docx", "Special_File.docx"},
+		{"IMG 2023 01 01.JPG", "IMG_2023_01_01.JPG"},
+		{"_MyFile__.txt", "MyFile.txt"},
+		{"__My__File__.txt", "My_File.txt"},
+	}
+	for _, test := range tests {
+		if got := Default().Clean(test.input); got != test.expected {
+			t.Errorf("%s: expected %s, got %s", test.input, test.expected, got)
+		}
+	}
+}
+
+func TestParseProfile(t *testing.T) {
+	// The shape viper returns for a YAML list of maps
+	raw := []interface{}{
+		map[string]interface{}{"rule": "strip-pattern", "pattern": `\(\d+\)`},
+		map[string]interface{}{"rule": "replace-chars", "pattern": `[^A-Za-z0-9]`, "with": "-"},
+		map[string]interface{}{"rule": "collapse-separators", "chars": "-"},
+		map[string]interface{}{"rule": "trim", "chars": "-"},
+		map[string]interface{}{"rule": "case", "style": "lower"},
+		map[string]interface{}{"rule": "max-length", "length": 8},
+	}
+	p, err := Parse("web", raw)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if got := p.Clean("My Holiday Photo (1).JPG"); got != "my-holid.JPG" {
+		t.Errorf("expected my-holid.JPG, got %s", got)
+	}
+}
+
+func TestParseProfileErrors(t *testing.T) {
+	tests := map[string]struct {
+		raw     interface{}
+		message string
+	}{
+		"undefined":      {nil, "not defined"},
+		"not a list":     {"trim", "list of rules"},
+		"unknown rule":   {[]interface{}{map[string]interface{}{"rule": "shout"}}, "unknown rule"},
+		"unknown option": {[]interface{}{map[string]interface{}{"rule": "trim", "char": "-"}}, "unknown option(s) char"},
+		"bad value":      {[]interface{}{map[string]interface{}{"rule": "max-length", "length": "long"}}, "whole number"},
+		"bad pattern":    {[]interface{}{map[string]interface{}{"rule": "strip-pattern", "pattern": "("}}, "invalid pattern"},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := Parse("custom", test.raw)
+			if err == nil || !strings.Contains(err.Error(), test.message) {
+				t.Errorf("expected an error containing %q, got %v", test.message, err)
+			}
+		})
+	}
+
+	// Without a config entry the default profile is the built-in one.
+	if p, err := Parse(DefaultProfile, nil); err != nil || p != Default() {
+		t.Errorf("expected the built-in default profile, got %v (%v)", p, err)
+	}
+}
+
+func TestUnicodeProfile(t *testing.T) {
+	p, err := Parse(UnicodeProfile, nil)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"写真 2023.jpg", "写真_2023.jpg"},
+		{"Café Crème!.txt", "Café_Crème.txt"},
+		{"Привет мир.doc", "Привет_мир.doc"},
+		{"会議資料　２０２４「最終版」.pdf", "会議資料_2024_最終版.pdf"},
+		{"ｶﾀｶﾅ・テスト.txt", "カタカナ_テスト.txt"},
+		{"cafe\u0301.txt", "caf\u00e9.txt"}, // NFD as written by macOS
+	}
+	for _, test := range tests {
+		if got := p.Clean(test.input); got != test.expected {
+			t.Errorf("%s: expected %s, got %s", test.input, test.expected, got)
+		}
+	}
+
+	nfkc, err := New("nfkc", []Spec{{"rule": "normalize", "form": "nfkc"}})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	if got := nfkc.Clean("①ﬁle.txt"); got != "1file.txt" {
+		t.Errorf("expected 1file.txt, got %s", got)
+	}
+}
+
+func TestTransliterate(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"Café Crème", "Cafe Creme"},
+		{"Straße Øresund Łódź", "Strasse Oresund Lodz"},
+		{"Москва Щука Ёлка", "Moskva Shchuka Elka"},
+		{"Львів", "Lviv"},
+		{"ОБЪЕКТ ВЪЕЗД Подъезд", "OBEKT VEZD Podezd"},
+		{"Αθήνα Ψυχή", "Athina Psychi"},
+		{"ひらがな カタカナ", "hiragana katakana"},
+		{"きょうと しゃしん じゅんび", "kyouto shashin junbi"},
+		{"ちょっと マッチャ がっこう", "chotto matcha gakkou"},
+		{"ティーシャツ ファイル ウィキ", "tishatsu fairu wiki"},
+		{"ｶﾀｶﾅ ＡＢＣ", "katakana ABC"},
+		{"東京タワー", "東京tawa"},
+	}
+	for _, test := range tests {
+		if got := transliterate(test.input); got != test.expected {
+			t.Errorf("%s: expected %s, got %s", test.input, test.expected, got)
+		}
+	}
+
+	p, err := Default().Prepend(Spec{"rule": "transliterate"})
+	if err != nil {
+		t.Fatalf("Prepend failed: %v", err)
+	}
+	if p.Name != "default+transliterate" {
+		t.Errorf("expected name default+transliterate, got %s", p.Name)
+	}
+	if got := p.Clean("Résumé (Ёлка).pdf"); got != "Resume_Elka.pdf" {
+		t.Errorf("expected Resume_Elka.pdf, got %s", got)
+	}
+}
+
+func TestCaseStyles(t *testing.T) {
+	tests := []struct {
+		style    string
+		expected string
+	}{
+		{"lower", "myfile-v2 htmlreport"},
+		{"upper", "MYFILE-V2 HTMLREPORT"},
+		{"snake", "my_file_v2_html_report"},
+		{"kebab", "my-file-v2-html-report"},
+		{"camel", "myFileV2HtmlReport"},
+		{"pascal", "MyFileV2HtmlReport"},
+		{"title", "My_File_V2_Html_Report"},
+	}
+	for _, test := range tests {
+		p, err := New("case", []Spec{{"rule": "case", "style": test.style}})
+		if err != nil {
+			t.Fatalf("%s: New failed: %v", test.style, err)
+		}
+		if got := p.Clean("myFile-v2 HTMLReport"); got != test.expected {
+			t.Errorf("%s: expected %s, got %s", test.style, test.expected, got)
+		}
+	}
+
+	// Extension rules only see the extension
+	p, err := Default().Append(
+		Spec{"rule": "case", "style": "kebab"},
+		Spec{"rule": "case", "style": "lower", "target": "extension"},
+	)
+	if err != nil {
+		t.Fatalf("Append failed: %v", err)
+	}
+	if got := p.Clean("Holiday Photo.JPG"); got != "holiday-photo.jpg" {
+		t.Errorf("expected holiday-photo.jpg, got %s", got)
+	}
+	if got := Default().Clean("Holiday Photo.JPG"); got != "Holiday_Photo.JPG" {
+		t.Errorf("Append must not change the original pipeline, got %s", got)
+	}
+
+	if _, err := New("bad", []Spec{{"rule": "case", "target": "stem"}}); err == nil {
+		t.Error("expected an error for an unknown target")
+	}
+}
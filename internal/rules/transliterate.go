@@ -0,0 +1,221 @@
+package rules
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+func init() {
+	Register("transliterate", newTransliterate)
+}
+
+// transliterate spells accented Latin, Cyrillic, Greek and kana in ASCII.
+// Characters it has no spelling for (e.g. kanji) are left for the following
+// rules to deal with.
+func newTransliterate(opts *Options) (Rule, error) {
+	return transformRule(transliterate), nil
+}
+
+func transliterate(name string) string {
+	// NFKC folds full-width and half-width forms and composes kana with
+	// their voicing marks, so every table lookup below sees one rune.
+	runes := []rune(norm.NFKC.String(name))
+
+	var b strings.Builder
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case r < utf8.RuneSelf:
+			b.WriteRune(r)
+		case isKana(r):
+			i = writeKana(&b, runes, i)
+		default:
+			b.WriteString(transliterateRune(r))
+		}
+	}
+	return b.String()
+}
+
+// transliterateRune looks r up in the letter table, or else strips its
+// diacritics (é → e, ά → α → a). A rune that still has no ASCII spelling is
+// returned unchanged.
+func transliterateRune(r rune) string {
+	if s, ok := letters[r]; ok {
+		return s
+	}
+	var b strings.Builder
+	for _, c := range norm.NFD.String(string(r)) {
+		switch {
+		case unicode.Is(unicode.Mn, c):
+		case c < utf8.RuneSelf:
+			b.WriteRune(c)
+		default:
+			s, ok := letters[c]
+			if !ok {
+				return string(r)
+			}
+			b.WriteString(s)
+		}
+	}
+	return b.String()
+}
+
+// letters maps lower case letters to their ASCII spelling; upper case entries
+// are added by init. Cyrillic follows the common passport spelling, Greek
+// ELOT 743.
+var letters = map[rune]string{
+	// Latin letters that do not decompose into a base letter and a mark
+	'ß': "ss", 'æ': "ae", 'œ': "oe", 'ø': "o", 'đ': "d", 'ð': "d", 'ł': "l",
+	'þ': "th", 'ı': "i", 'ħ': "h", 'ŧ': "t", 'ŋ': "ng", 'ĸ': "q",
+
+	// Cyrillic
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ё': "e",
+	'ж': "zh", 'з': "z", 'и': "i", 'й': "y", 'к': "k", 'л': "l", 'м': "m",
+	'н': "n", 'о': "o", 'п': "p", 'р': "r", 'с': "s", 'т': "t", 'у': "u",
+	'ф': "f", 'х': "kh", 'ц': "ts", 'ч': "ch", 'ш': "sh", 'щ': "shch",
+	'ъ': "", 'ы': "y", 'ь': "", 'э': "e", 'ю': "yu", 'я': "ya",
+	'є': "ye", 'і': "i", 'ї': "yi", 'ґ': "g", 'ў': "u",
+	'ђ': "dj", 'ј': "j", 'љ': "lj", 'њ': "nj", 'ћ': "c", 'џ': "dz",
+	'ѓ': "gj", 'ќ': "kj", 'ѕ': "dz",
+
+	// Greek
+	'α': "a", 'β': "v", 'γ': "g", 'δ': "d", 'ε': "e", 'ζ': "z", 'η': "i",
+	'θ': "th", 'ι': "i", 'κ': "k", 'λ': "l", 'μ': "m", 'ν': "n", 'ξ': "x",
+	'ο': "o", 'π': "p", 'ρ': "r", 'σ': "s", 'ς': "s", 'τ': "t", 'υ': "y",
+	'φ': "f", 'χ': "ch", 'ψ': "ps", 'ω': "o",
+}
+
+func init() {
+	for r, s := range letters {
+		upper := unicode.ToUpper(r)
+		if upper == r {
+			continue
+		}
+		if _, ok := letters[upper]; ok {
+			continue
+		}
+		if s == "" {
+			// ъ and ь have no spelling in either case
+			letters[upper] = ""
+		} else {
+			letters[upper] = strings.ToUpper(s[:1]) + s[1:]
+		}
+	}
+	letters['ẞ'] = "SS"
+}
+
+// kana holds the Hepburn spelling of each hiragana; katakana are looked up
+// through their hiragana counterpart.
+var kana = map[rune]string{
+	'あ': "a", 'い': "i", 'う': "u", 'え': "e", 'お': "o",
+	'か': "ka", 'き': "ki", 'く': "ku", 'け': "ke", 'こ': "ko",
+	'が': "ga", 'ぎ': "gi", 'ぐ': "gu", 'げ': "ge", 'ご': "go",
+	'さ': "sa", 'し': "shi", 'す': "su", 'せ': "se", 'そ': "so",
+	'ざ': "za", 'じ': "ji", 'ず': "zu", 'ぜ': "ze", 'ぞ': "zo",
+	'た': "ta", 'ち': "chi", 'つ': "tsu", 'て': "te", 'と': "to",
+	'だ': "da", 'ぢ': "ji", 'づ': "zu", 'で': "de", 'ど': "do",
+	'な': "na", 'に': "ni", 'ぬ': "nu", 'ね': "ne", 'の': "no",
+	'は': "ha", 'ひ': "hi", 'ふ': "fu", 'へ': "he", 'ほ': "ho",
+	'ば': "ba", 'び': "bi", 'ぶ': "bu", 'べ': "be", 'ぼ': "bo",
+	'ぱ': "pa", 'ぴ': "pi", 'ぷ': "pu", 'ぺ': "pe", 'ぽ': "po",
+	'ま': "ma", 'み': "mi", 'む': "mu", 'め': "me", 'も': "mo",
+	'や': "ya", 'ゆ': "yu", 'よ': "yo",
+	'ら': "ra", 'り': "ri", 'る': "ru", 'れ': "re", 'ろ': "ro",
+	'わ': "wa", 'ゐ': "i", 'ゑ': "e", 'を': "o", 'ん': "n", 'ゔ': "vu",
+	'ぁ': "a", 'ぃ': "i", 'ぅ': "u", 'ぇ': "e", 'ぉ': "o",
+	'ゃ': "ya", 'ゅ': "yu", 'ょ': "yo", 'ゎ': "wa", 'ゕ': "ka", 'ゖ': "ke",
+	'ヷ': "va", 'ヸ': "vi", 'ヹ': "ve", 'ヺ': "vo",
+}
+
+const (
+	sokuonHiragana = 'っ'
+	sokuonKatakana = 'ッ'
+	longVowel      = 'ー'
+)
+
+func isKana(r rune) bool {
+	return (r >= 'ぁ' && r <= 'ゖ') || (r >= 'ァ' && r <= 'ヺ') || r == longVowel
+}
+
+// romaji returns the spelling of a single kana
+func romaji(r rune) (string, bool) {
+	if r >= 'ァ' && r <= 'ヶ' {
+		r -= 'ァ' - 'ぁ'
+	}
+	s, ok := kana[r]
+	return s, ok
+}
+
+func isSmall(r rune) bool {
+	switch r {
+	case 'ぁ', 'ぃ', 'ぅ', 'ぇ', 'ぉ', 'ゃ', 'ゅ', 'ょ', 'ァ', 'ィ', 'ゥ', 'ェ', 'ォ', 'ャ', 'ュ', 'ョ':
+		return true
+	}
+	return false
+}
+
+// writeKana writes the syllable starting at runes[i] and returns the index of
+// its last rune. Small kana combine with the previous one (きょ → kyo,
+// ティ → ti), a small tsu doubles the next consonant (っと → tto, っち →
+// tchi) and the long vowel mark is dropped, as in passport spelling.
+func writeKana(b *strings.Builder, runes []rune, i int) int {
+	r := runes[i]
+	switch r {
+	case longVowel:
+		return i
+	case sokuonHiragana, sokuonKatakana:
+		if i+1 < len(runes) && isKana(runes[i+1]) {
+			var next strings.Builder
+			j := writeKana(&next, runes, i+1)
+			s := next.String()
+			switch {
+			case strings.HasPrefix(s, "ch"):
+				b.WriteByte('t')
+			case s != "" && !strings.ContainsRune("aeiou", rune(s[0])):
+				b.WriteByte(s[0])
+			}
+			b.WriteString(s)
+			return j
+		}
+		return i
+	}
+
+	s, ok := romaji(r)
+	if !ok {
+		b.WriteRune(r)
+		return i
+	}
+	if i+1 < len(runes) && isSmall(runes[i+1]) && len(s) > 1 {
+		small, _ := romaji(runes[i+1])
+		stem := s[:len(s)-1]
+		switch {
+		case len(small) == 2 && s[len(s)-1] == 'i':
+			// きゃ → kya, しゃ → sha, じょ → jo
+			if strings.HasSuffix(stem, "h") || stem == "j" {
+				small = small[1:]
+			}
+			s = stem + small
+		case len(small) == 1:
+			// ファ → fa, ティ → ti, シェ → she
+			s = stem + small
+		default:
+			b.WriteString(s)
+			return i
+		}
+		b.WriteString(s)
+		return i + 1
+	}
+	if s == "u" && i+1 < len(runes) && isSmall(runes[i+1]) {
+		// ウィ → wi
+		small, _ := romaji(runes[i+1])
+		if len(small) == 1 {
+			b.WriteString("w" + small)
+			return i + 1
+		}
+	}
+	b.WriteString(s)
+	return i
+}
@@ -0,0 +1,54 @@
+package rules
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+	"golang.org/x/text/width"
+)
+
+// unicodeUnwanted matches everything but letters, marks and digits of any
+// script, underscores and dots. Marks are kept so combining characters (e.g.
+// dakuten in NFD names from macOS) stay with their letter.
+const unicodeUnwanted = `[^\p{L}\p{M}\p{N}_.]`
+
+func init() {
+	Register("normalize", newNormalize)
+	Register("fold-width", newFoldWidth)
+}
+
+// transformRule applies a function to the whole name
+type transformRule func(string) string
+
+func (r transformRule) Apply(name string) string {
+	return r(name)
+}
+
+// normalize converts the name to a Unicode normalization form. NFC composes
+// characters, NFKC additionally folds compatibility characters such as
+// full-width letters, circled digits and ligatures.
+func newNormalize(opts *Options) (Rule, error) {
+	form, err := opts.String("form", "nfc")
+	if err != nil {
+		return nil, err
+	}
+	switch strings.ToLower(form) {
+	case "nfc":
+		return transformRule(norm.NFC.String), nil
+	case "nfd":
+		return transformRule(norm.NFD.String), nil
+	case "nfkc":
+		return transformRule(norm.NFKC.String), nil
+	case "nfkd":
+		return transformRule(norm.NFKD.String), nil
+	}
+	return nil, fmt.Errorf("unknown form %q (expected nfc, nfd, nfkc or nfkd)", form)
+}
+
+// fold-width maps full-width ASCII (letters, digits, punctuation and the
+// ideographic space) to their normal forms and half-width katakana to
+// full-width, leaving other characters alone.
+func newFoldWidth(opts *Options) (Rule, error) {
+	return transformRule(width.Fold.String), nil
+}
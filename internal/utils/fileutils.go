@@ -4,7 +4,6 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
-	"regexp"
 	"strings"
 )
 
@@ -17,27 +16,6 @@ func IsDirectory(path string) bool {
     return info.IsDir()
 }
 
-// CleanFileName cleans up the file name by replacing unwanted characters
-func CleanFileName(fileName string) string {
-	// Remove file extension
-	ext := filepath.Ext(fileName)
-	baseName := fileName[:len(fileName)-len(ext)]
-
-	// Replace non-alphanumeric characters (except dot) with an underscore
-	reClean := regexp.MustCompile(`[^\w\d.]`)
-	baseName = reClean.ReplaceAllString(baseName, "_")
-
-	// Replace consecutive underscores with a single underscore
-	reUnderscore := regexp.MustCompile(`_+`)
-	baseName = reUnderscore.ReplaceAllString(baseName, "_")
-
-	// Remove leading and trailing underscores
-	baseName = strings.Trim(baseName, "_")
-
-	// Restore file extension
-	return baseName + ext
-}
-
 // RenameFile renames a file from oldPath to newPath
 func RenameFile(oldPath, newPath string, dryRun bool) error {
     if dryRun {
@@ -54,6 +32,15 @@ func RenameFile(oldPath, newPath string, dryRun bool) error {
     return nil
 }
 
+// IsWithin checks if path is root itself or lies somewhere below it
+func IsWithin(root, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) && !filepath.IsAbs(rel)
+}
+
 // FileExists checks if the specified file exists at the given path
 func FileExists(path string) bool {
     _, err := os.Stat(path)
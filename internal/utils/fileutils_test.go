@@ -32,28 +32,6 @@ func TestIsDirectory(t *testing.T) {
 	}
 }
 
-func TestCleanFileName(t *testing.T) {
-	tests := []struct {
-		input    string
-		expected string
-	}{
-		{"My_File___.txt", "My_File.txt"},
-		{"Special$$File!.docx", "Special_File.docx"},
-		{"IMG 2023 01 01.JPG", "IMG_2023_01_01.JPG"},
-		{"_MyFile__.txt", "MyFile.txt"},
-		{"__My__File__.txt", "My_File.txt"},
-	}
-
-	for _, test := range tests {
-		t.Run(test.input, func(t *testing.T) {
-			output := CleanFileName(test.input)
-			if output != test.expected {
-				t.Errorf("expected %s, got %s", test.expected, output)
-			}
-		})
-	}
-}
-
 func TestRenameFileDryRun(t *testing.T) {
 	// テスト用のディレクトリをセットアップ
 	dir := "test_dir"
@@ -129,3 +107,26 @@ func TestFileExists(t *testing.T) {
 		t.Errorf("expected file to not exist")
 	}
 }
+
+func TestIsWithin(t *testing.T) {
+	root := filepath.Join(string(filepath.Separator), "data", "photos")
+	tests := []struct {
+		path     string
+		expected bool
+	}{
+		{root, true},
+		{filepath.Join(root, "a.jpg"), true},
+		{filepath.Join(root, "2023", "a.jpg"), true},
+		{filepath.Join(root, "..", "docs", "a.txt"), false},
+		{filepath.Join(string(filepath.Separator), "data", "photos2", "a.jpg"), false},
+		{filepath.Join(root, "..photos", "a.jpg"), true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.path, func(t *testing.T) {
+			if got := IsWithin(root, test.path); got != test.expected {
+				t.Errorf("IsWithin(%s, %s) = %v, expected %v", root, test.path, got, test.expected)
+			}
+		})
+	}
+}
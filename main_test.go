@@ -176,3 +176,35 @@ func TestInvalidDirectory(t *testing.T) {
 		t.Errorf("存在しないディレクトリのエラーメッセージが正しくありません。出力: %s", string(output))
 	}
 }
+
+// TestExitCodes - 終了コードのテスト
+func TestExitCodes(t *testing.T) {
+	os.Mkdir(testDir, 0755)
+	os.WriteFile(filepath.Join(testDir, "already_clean.txt"), []byte("test content"), 0644)
+	defer teardownTestEnvironment()
+
+	skipDir := t.TempDir()
+	os.WriteFile(filepath.Join(skipDir, "a b.txt"), []byte("test content"), 0644)
+	os.WriteFile(filepath.Join(skipDir, "a_b.txt"), []byte("test content"), 0644)
+
+	exeName := buildExecutable(t)
+
+	tests := []struct {
+		args []string
+		code int
+	}{
+		{[]string{"clean", "--path=invalid_dir"}, 2},
+		{[]string{"clean"}, 2},
+		{[]string{"clean", "--path=" + testDir, "--on-conflict=maybe"}, 2},
+		{[]string{"undo", "--path=" + testDir, "--force"}, 2},
+		{[]string{"clean", "--path=" + testDir}, 3},
+		{[]string{"clean", "--path=" + skipDir, "--on-conflict=skip"}, 3},
+	}
+	for _, test := range tests {
+		cmd := exec.Command("./"+exeName, test.args...)
+		output, _ := cmd.CombinedOutput()
+		if code := cmd.ProcessState.ExitCode(); code != test.code {
+			t.Errorf("%v: 終了コード %d を期待しましたが %d でした。出力: %s", test.args, test.code, code, string(output))
+		}
+	}
+}